@@ -0,0 +1,185 @@
+package main
+
+import (
+	"github.com/creack/uuid"
+)
+
+// Clone returns a deep copy of the user.
+// Mutating the copy, including its memberships, payment plan and owner, never affects the original.
+func (u *User) Clone() *User {
+	return newCloner().user(u)
+}
+
+// Clone returns a deep copy of the organization. See User.Clone.
+func (o *Organization) Clone() *Organization {
+	return newCloner().organization(o)
+}
+
+// Clone returns a deep copy of the team. See User.Clone.
+func (t *Team) Clone() *Team {
+	return newCloner().team(t)
+}
+
+// Clone returns a deep copy of the payment plan. See User.Clone.
+func (pp *PaymentPlan) Clone() *PaymentPlan {
+	return newCloner().paymentPlan(pp)
+}
+
+// cloner deep copies a model graph.
+// Already cloned objects are memoized so shared pointers stay shared and cycles terminate,
+// i.e. a Team pointing back to the Organization listing it.
+type cloner struct {
+	users         map[*User]*User
+	organizations map[*Organization]*Organization
+	teams         map[*Team]*Team
+}
+
+func newCloner() *cloner {
+	return &cloner{
+		users:         map[*User]*User{},
+		organizations: map[*Organization]*Organization{},
+		teams:         map[*Team]*Team{},
+	}
+}
+
+func cloneUUID(id uuid.UUID) uuid.UUID {
+	if id == nil {
+		return nil
+	}
+	return append(uuid.UUID{}, id...)
+}
+
+func (c *cloner) timeMetadata(tm TimeMetadata) TimeMetadata {
+	if tm.DeletedAt != nil {
+		deletedAt := *tm.DeletedAt
+		tm.DeletedAt = &deletedAt
+	}
+	return tm
+}
+
+func (c *cloner) metadata(m Metadata) Metadata {
+	return Metadata{
+		Owner:        c.user(m.Owner),
+		CreatedBy:    c.user(m.CreatedBy),
+		TimeMetadata: c.timeMetadata(m.TimeMetadata),
+	}
+}
+
+func (c *cloner) user(u *User) *User {
+	if u == nil {
+		return nil
+	}
+	if dup, ok := c.users[u]; ok {
+		return dup
+	}
+	dup := &User{ID: cloneUUID(u.ID)}
+	c.users[u] = dup
+
+	if u.Organizations != nil {
+		dup.Organizations = make(UserOrganizations, len(u.Organizations))
+		for i, uo := range u.Organizations {
+			dup.Organizations[i] = c.userOrganization(uo)
+		}
+	}
+	if u.Teams != nil {
+		dup.Teams = make([]UserTeam, len(u.Teams))
+		for i, ut := range u.Teams {
+			dup.Teams[i] = c.userTeam(ut)
+		}
+	}
+	dup.PaymentPlan = c.paymentPlan(u.PaymentPlan)
+	dup.Metadata = c.metadata(u.Metadata)
+	return dup
+}
+
+func (c *cloner) userOrganization(uo UserOrganization) UserOrganization {
+	return UserOrganization{
+		UserID:         cloneUUID(uo.UserID),
+		OrganizationID: cloneUUID(uo.OrganizationID),
+		Role:           uo.Role,
+		Metadata:       c.metadata(uo.Metadata),
+	}
+}
+
+func (c *cloner) userTeam(ut UserTeam) UserTeam {
+	return UserTeam{
+		UserID:         cloneUUID(ut.UserID),
+		OrganizationID: cloneUUID(ut.OrganizationID),
+		TeamID:         cloneUUID(ut.TeamID),
+		Role:           ut.Role,
+		Metadata:       c.metadata(ut.Metadata),
+	}
+}
+
+func (c *cloner) organization(o *Organization) *Organization {
+	if o == nil {
+		return nil
+	}
+	if dup, ok := c.organizations[o]; ok {
+		return dup
+	}
+	dup := &Organization{ID: cloneUUID(o.ID)}
+	c.organizations[o] = dup
+
+	if o.Users != nil {
+		dup.Users = make(OrganizationUsers, len(o.Users))
+		for i, uo := range o.Users {
+			if uo != nil {
+				elem := c.userOrganization(*uo)
+				dup.Users[i] = &elem
+			}
+		}
+	}
+	if o.Teams != nil {
+		dup.Teams = make(Teams, len(o.Teams))
+		for i, t := range o.Teams {
+			dup.Teams[i] = c.team(t)
+		}
+	}
+	dup.PaymentPlan = c.paymentPlan(o.PaymentPlan)
+	dup.Metadata = c.metadata(o.Metadata)
+	return dup
+}
+
+func (c *cloner) team(t *Team) *Team {
+	if t == nil {
+		return nil
+	}
+	if dup, ok := c.teams[t]; ok {
+		return dup
+	}
+	dup := &Team{
+		ID:           cloneUUID(t.ID),
+		Name:         t.Name,
+		Capacity:     t.Capacity,
+		CapacityNull: t.CapacityNull,
+	}
+	c.teams[t] = dup
+
+	dup.Organization = c.organization(t.Organization)
+	if t.Users != nil {
+		dup.Users = make(TeamUsers, len(t.Users))
+		for i, ut := range t.Users {
+			if ut != nil {
+				elem := c.userTeam(*ut)
+				dup.Users[i] = &elem
+			}
+		}
+	}
+	dup.Metadata = c.metadata(t.Metadata)
+	return dup
+}
+
+func (c *cloner) paymentPlan(pp *PaymentPlan) *PaymentPlan {
+	if pp == nil {
+		return nil
+	}
+	return &PaymentPlan{
+		ID:       cloneUUID(pp.ID),
+		Name:     pp.Name,
+		Cost:     pp.Cost,
+		Currency: pp.Currency,
+		Term:     pp.Term,
+		Metadata: c.metadata(pp.Metadata),
+	}
+}
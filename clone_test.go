@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserClone(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	userID := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	orgID := MustParseUUID("00000000-0000-0000-0000-000000000002")
+	src := &User{
+		ID:            userID,
+		Organizations: UserOrganizations{{UserID: userID, OrganizationID: orgID, Role: RoleMember}},
+		Teams:         []UserTeam{{UserID: userID, OrganizationID: orgID, Role: RoleMember}},
+		PaymentPlan:   &PaymentPlan{ID: MustParseUUID("00000000-0000-0000-0000-000000000003"), Name: "pro", Currency: "USD", Term: TermMonthly},
+		Metadata: Metadata{
+			Owner:        &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000004")},
+			TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts, DeletedAt: &ts},
+		},
+	}
+	snapshot := src.Clone()
+	if !snapshot.Equal(src) {
+		t.Fatalf("Expected an equal clone, got %v", snapshot)
+	}
+
+	dup := src.Clone()
+	dup.ID[0] = 0xff
+	dup.Organizations[0].Role = RoleAdmin
+	dup.Organizations[0].OrganizationID[0] = 0xff
+	dup.Teams[0].Role = RoleAdmin
+	dup.PaymentPlan.Name = "free"
+	dup.Metadata.Owner.ID[0] = 0xff
+	*dup.Metadata.DeletedAt = Now()
+	if !src.Equal(snapshot) {
+		t.Fatalf("Mutating the clone changed the source: %v", src)
+	}
+}
+
+func TestOrganizationCloneCycle(t *testing.T) {
+	o := NewOrganization()
+	team := NewTeam("core", 2)
+	team.Organization = o
+	o.Teams = Teams{team}
+
+	dup := o.Clone()
+	if dup == o || dup.Teams[0] == team {
+		t.Fatal("Expected newly allocated organization and team")
+	}
+	if dup.Teams[0].Organization != dup {
+		t.Fatal("Expected the cloned team to point back to the cloned organization")
+	}
+	dup.Teams[0].Name = "ops"
+	if team.Name != "core" {
+		t.Fatalf("Mutating the clone changed the source team: %s", team.Name)
+	}
+}
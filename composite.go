@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// parseComposite splits a Postgres composite literal, i.e. `(a,"b,c",d)`, into its fields.
+// Double-quoted fields are unquoted and may contain commas and parentheses;
+// an embedded `""` is unescaped to `"`.
+// A backslash escapes the next character, quoted or not, i.e. `\\` is `\` and `\"` is `"`.
+// A nested composite is returned as one field holding the inner composite literal, ready for parseComposite:
+// Postgres quotes it, i.e. `(a,"(b,""c d"")")`, so one level of quoting is removed,
+// while an unquoted nested group, i.e. `(a,(b,"c d"))`, is kept verbatim.
+// An unquoted empty field is a SQL NULL and is returned as invalid,
+// while a quoted empty field (`""`) is a valid empty string.
+// Surrounding whitespace, i.e. from pretty-printed queries, is ignored.
+func parseComposite(s string) ([]sql.NullString, error) {
+	return parseCompositeBytes([]byte(s))
+}
+
+// parseCompositeBytes is parseComposite working on bytes, as scanned from the driver,
+// so the composite is copied once, field by field, instead of first converted to a string.
+func parseCompositeBytes(b []byte) ([]sql.NullString, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) < 2 || b[0] != '(' || b[len(b)-1] != ')' {
+		return nil, errors.New("composite must be enclosed in parentheses")
+	}
+	b = b[1 : len(b)-1]
+
+	var (
+		fields []sql.NullString
+		field  strings.Builder
+		quoted bool
+	)
+	for i := 0; i <= len(b); i++ {
+		if i == len(b) || b[i] == ',' {
+			fields = append(fields, sql.NullString{String: field.String(), Valid: quoted || field.Len() > 0})
+			field.Reset()
+			quoted = false
+			continue
+		}
+		if b[i] == '\\' {
+			if i++; i >= len(b) {
+				return nil, errors.New("unterminated escape in composite")
+			}
+			field.WriteByte(b[i])
+			continue
+		}
+		if b[i] == '(' && field.Len() == 0 && !quoted {
+			end, err := nestedCompositeEnd(b, i)
+			if err != nil {
+				return nil, err
+			}
+			field.Write(b[i : end+1])
+			i = end
+			continue
+		}
+		if b[i] != '"' {
+			field.WriteByte(b[i])
+			continue
+		}
+		// Quoted section: read until the closing quote, unescaping doubled quotes and backslashes.
+		quoted = true
+		for i++; ; i++ {
+			if i >= len(b) {
+				return nil, errors.New("unterminated quoted field in composite")
+			}
+			if b[i] == '\\' {
+				if i++; i >= len(b) {
+					return nil, errors.New("unterminated quoted field in composite")
+				}
+				field.WriteByte(b[i])
+				continue
+			}
+			if b[i] == '"' {
+				if i+1 < len(b) && b[i+1] == '"' {
+					field.WriteByte('"')
+					i++
+					continue
+				}
+				break
+			}
+			field.WriteByte(b[i])
+		}
+	}
+	return fields, nil
+}
+
+// nestedCompositeEnd returns the index of the parenthesis closing the one at the given index,
+// skipping over the quoted sections and the escaped characters.
+func nestedCompositeEnd(b []byte, start int) (int, error) {
+	depth, quoted := 0, false
+	for i := start; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth--; depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, errors.New("unterminated nested composite")
+}
+
+// isJSONObject returns true if the scanned source is a JSON object, i.e. from a jsonb column,
+// rather than a composite.
+func isJSONObject(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && b[0] == '{'
+}
+
+// isHStore returns true if the scanned source is an hstore, i.e. `"key"=>"value"`, rather than a composite.
+// The hstore keys are always quoted on output, while a composite starts with a parenthesis.
+func isHStore(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && b[0] == '"' && bytes.Contains(b, []byte("=>"))
+}
+
+// joinComposite is the inverse of parseComposite: it rebuilds a composite literal
+// from the given fields, encoding valid ones and leaving NULL ones empty.
+func joinComposite(fields []sql.NullString) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		if field.Valid {
+			parts[i] = encodeCompositeField(field.String)
+		}
+	}
+	return "(" + strings.Join(parts, ",") + ")"
+}
+
+// countError returns an ErrInvalidCount wrapped with the expected and actual field counts
+// and a snippet of the offending composite.
+func countError(typ string, expected, actual int, src string) error {
+	const maxSnippet = 64
+
+	if len(src) > maxSnippet {
+		src = src[:maxSnippet] + "..."
+	}
+	return errors.Wrapf(ErrInvalidCount, "%s scan: expected %d fields, got %d in %q", typ, expected, actual, src)
+}
+
+// encodeCompositeField encodes a composite field following the Postgres output rules:
+// the field is double-quoted, with its embedded quotes and backslashes doubled,
+// only when empty or containing a comma, a parenthesis, a quote, a backslash or whitespace.
+// Quoting an empty field keeps it distinct from NULL.
+func encodeCompositeField(s string) string {
+	if s != "" && !strings.ContainsAny(s, ",()\"\\ \t\n\r\v\f") {
+		return s
+	}
+	return `"` + compositeEscaper.Replace(s) + `"`
+}
+
+// compositeEscaper escapes the quoted fields of a Postgres composite.
+var compositeEscaper = strings.NewReplacer(`"`, `""`, `\`, `\\`)
+
+// CompositeLiteral returns the value of v, i.e. a Metadata composite, as a single-quoted SQL literal
+// to embed in a raw query, i.e. `'(,2020-01-01T00:00:00.000000Z,2020-01-01T00:00:00.000000Z,)'`.
+// A NULL value is returned as `NULL`.
+// The embedded single quotes are doubled, which assumes standard_conforming_strings, the Postgres default.
+// Prefer the bind parameters whenever possible: the string fields of v, i.e. a team name,
+// may come from user input and inlining them is only as safe as this escaping.
+func CompositeLiteral(v driver.Valuer) (string, error) {
+	val, err := v.Value()
+	if err != nil {
+		return "", errors.Wrap(err, "error value composite literal")
+	}
+	if val == nil {
+		return "NULL", nil
+	}
+	s, err := ScanToString(val)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid type for composite literal")
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'", nil
+}
+
+// parseArray parses a Postgres array, typically the result of `array_agg`,
+// and returns its elements. NULL elements are skipped.
+// A bare composite, as returned by some query shapes instead of a one element array, is accepted as such.
+func parseArray(src interface{}) ([]string, error) {
+	if src != nil {
+		s, err := ScanToString(src)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid type for array scan")
+		}
+		if s = strings.TrimSpace(s); strings.HasPrefix(s, "(") {
+			return []string{s}, nil
+		}
+	}
+
+	var elems []sql.NullString
+
+	if err := pq.Array(&elems).Scan(src); err != nil {
+		return nil, errors.Wrap(err, "error parsing db result into string array")
+	}
+
+	strArray := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		if elem.Valid {
+			strArray = append(strArray, elem.String)
+		}
+	}
+	return strArray, nil
+}
+
+// marshalCompositeArray returns the Postgres array literal of the given composites, i.e. `{"(a,b)","(c,d)"}`.
+// Each Valuer must produce a composite string; nil Valuers are emitted as NULL.
+func marshalCompositeArray(elems []driver.Valuer) (string, error) {
+	strArray := make([]string, len(elems))
+	for i, elem := range elems {
+		if elem == nil {
+			strArray[i] = "NULL"
+			continue
+		}
+		v, err := elem.Value()
+		if err != nil {
+			return "", errors.Wrapf(err, "error value array element %d", i)
+		}
+		s, err := ScanToString(v)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid type for array element %d", i)
+		}
+		strArray[i] = `"` + arrayEscaper.Replace(s) + `"`
+	}
+	return "{" + strings.Join(strArray, ",") + "}", nil
+}
+
+// arrayEscaper escapes the quoted elements of a Postgres array.
+var arrayEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
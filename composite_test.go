@@ -0,0 +1,340 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// str returns a valid, non-NULL, composite field.
+func str(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
+func TestParseCompositeQuoted(t *testing.T) {
+	for _, tc := range []struct {
+		src    string
+		expect []sql.NullString
+	}{
+		{`(a,b,c)`, []sql.NullString{str("a"), str("b"), str("c")}},
+		{`(a,"admin, read-only",c)`, []sql.NullString{str("a"), str("admin, read-only"), str("c")}},
+		{`(a,"admin (legacy)",c)`, []sql.NullString{str("a"), str("admin (legacy)"), str("c")}},
+		{`(a,"say ""hi""",c)`, []sql.NullString{str("a"), str(`say "hi"`), str("c")}},
+		{`("a""b,c")`, []sql.NullString{str(`a"b,c`)}},
+	} {
+		got, err := parseComposite(tc.src)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", tc.src, err)
+		}
+		if !reflect.DeepEqual(got, tc.expect) {
+			t.Fatalf("%s: expected %v, got %v", tc.src, tc.expect, got)
+		}
+	}
+
+	for _, src := range []string{``, `a,b`, `(a,"b)`, `(a`} {
+		if _, err := parseComposite(src); err == nil {
+			t.Fatalf("Expected an error parsing %q", src)
+		}
+	}
+}
+
+func TestUserOrganizationScanQuotedMetadata(t *testing.T) {
+	src := `(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,"admin","(,""2020-01-02 03:04:05+00"",""2020-01-02 03:04:05+00"",)")`
+	var uo UserOrganization
+	if err := uo.Scan(src); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if uo.Role != RoleAdmin || uo.Metadata.Owner != nil || uo.Metadata.CreatedAt.IsZero() {
+		t.Fatalf("Unexpected membership %v", uo)
+	}
+}
+
+func TestParseCompositeNull(t *testing.T) {
+	null := sql.NullString{}
+	for _, tc := range []struct {
+		src    string
+		expect []sql.NullString
+	}{
+		{`(,,,)`, []sql.NullString{null, null, null, null}},
+		{`("",,,)`, []sql.NullString{str(""), null, null, null}},
+		{`(a,"",,d)`, []sql.NullString{str("a"), str(""), null, str("d")}},
+		{`()`, []sql.NullString{null}},
+	} {
+		got, err := parseComposite(tc.src)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", tc.src, err)
+		}
+		if !reflect.DeepEqual(got, tc.expect) {
+			t.Fatalf("%s: expected %v, got %v", tc.src, tc.expect, got)
+		}
+	}
+}
+
+func TestMetadataScanNullOwner(t *testing.T) {
+	var m Metadata
+	if err := m.Scan1(`(,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if m.Owner != nil || m.DeletedAt != nil {
+		t.Fatalf("Expected no owner nor deleted_at, got %v", m)
+	}
+	if err := m.Scan1(`("",2020-01-02,2020-01-02,)`); err == nil {
+		t.Fatal("Expected an error for an empty, non-NULL, owner_id")
+	}
+}
+
+// compositeValuer is a driver.Valuer returning a fixed composite.
+type compositeValuer string
+
+func (v compositeValuer) Value() (driver.Value, error) { return string(v), nil }
+
+func TestMarshalCompositeArray(t *testing.T) {
+	elems := []driver.Valuer{compositeValuer(`(a,"b c")`), nil, compositeValuer(`(\\,d)`)}
+	got, err := marshalCompositeArray(elems)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if expect := `{"(a,\"b c\")",NULL,"(\\\\,d)"}`; got != expect {
+		t.Fatalf("Expected %s, got %s", expect, got)
+	}
+
+	strArray, err := parseArray([]byte(got))
+	if err != nil {
+		t.Fatalf("Error parsing %s: %s", got, err)
+	}
+	if len(strArray) != 2 || strArray[0] != `(a,"b c")` || strArray[1] != `(\\,d)` {
+		t.Fatalf("Unexpected elements %q", strArray)
+	}
+}
+
+func TestCountError(t *testing.T) {
+	var m Metadata
+	err := m.Scan1(`(a,b)`)
+	if !errors.Is(err, ErrInvalidCount) {
+		t.Fatalf("Expected ErrInvalidCount, got %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "expected 4 fields, got 2") || !strings.Contains(msg, `"(a,b)"`) {
+		t.Fatalf("Expected the counts and the source in %q", msg)
+	}
+
+	var tm TimeMetadata
+	if err := tm.Scan1(`(a)`); err == nil || !strings.Contains(err.Error(), "got 1") {
+		t.Fatalf("Expected the actual count in %v", err)
+	}
+	var uo UserOrganization
+	if err := uo.Scan(`(a,b)`); err == nil || !strings.Contains(err.Error(), "got 2") {
+		t.Fatalf("Expected the actual count in %v", err)
+	}
+
+	long := "(" + strings.Repeat("x", 100) + ")"
+	if msg := countError("Metadata", 4, 1, long).Error(); strings.Contains(msg, long) || !strings.Contains(msg, `..."`) {
+		t.Fatalf("Expected a truncated source in %q", msg)
+	}
+}
+
+func TestParseCompositeWhitespace(t *testing.T) {
+	expect, err := parseComposite(`(a,b,c)`)
+	if err != nil {
+		t.Fatalf("Error parsing the reference composite: %s", err)
+	}
+	for _, src := range []string{"  (a,b,c)\n", "\t(a,b,c)", "\r\n(a,b,c) \r\n"} {
+		got, err := parseComposite(src)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %s", src, err)
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Fatalf("%q: expected %v, got %v", src, expect, got)
+		}
+		if got, err := parseCompositeBytes([]byte(src)); err != nil || !reflect.DeepEqual(got, expect) {
+			t.Fatalf("%q: expected %v from the bytes tokenizer, got %v (%v)", src, expect, got, err)
+		}
+	}
+
+	// The whitespace inside the parens is part of the fields.
+	got, err := parseComposite(" ( a ,b) ")
+	if err != nil {
+		t.Fatalf("Error parsing the padded fields: %s", err)
+	}
+	if !reflect.DeepEqual(got, []sql.NullString{str(" a "), str("b")}) {
+		t.Fatalf("Unexpected padded fields %v", got)
+	}
+}
+
+func TestEncodeCompositeField(t *testing.T) {
+	for _, tc := range []struct {
+		src, expect string
+	}{
+		{`admin`, `admin`},
+		{`2020-01-02T03:04:05.000000Z`, `2020-01-02T03:04:05.000000Z`},
+		{``, `""`},
+		{`admin, read-only`, `"admin, read-only"`},
+		{`admin (legacy)`, `"admin (legacy)"`},
+		{`say "hi"`, `"say ""hi"""`},
+		{`a\b`, `"a\\b"`},
+		{"a\tb", "\"a\tb\""},
+	} {
+		got := encodeCompositeField(tc.src)
+		if got != tc.expect {
+			t.Fatalf("%q: expected %s, got %s", tc.src, tc.expect, got)
+		}
+		parts, err := parseComposite("(" + got + ")")
+		if err != nil {
+			t.Fatalf("Error parsing back %s: %s", got, err)
+		}
+		if len(parts) != 1 || parts[0] != str(tc.src) {
+			t.Fatalf("%q: unexpected round trip %v", tc.src, parts)
+		}
+	}
+}
+
+func TestParseCompositeBackslash(t *testing.T) {
+	for _, tc := range []struct {
+		src    string
+		expect []sql.NullString
+	}{
+		{`(a,"a\\b",c)`, []sql.NullString{str("a"), str(`a\b`), str("c")}},
+		{`(a,"say \"hi\"",c)`, []sql.NullString{str("a"), str(`say "hi"`), str("c")}},
+		{`("\\\\","\,")`, []sql.NullString{str(`\\`), str(",")}},
+		{`(a\,b,c)`, []sql.NullString{str("a,b"), str("c")}},
+	} {
+		got, err := parseComposite(tc.src)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", tc.src, err)
+		}
+		if !reflect.DeepEqual(got, tc.expect) {
+			t.Fatalf("%s: expected %v, got %v", tc.src, tc.expect, got)
+		}
+	}
+
+	if _, err := parseComposite(`(a,"b\")`); err == nil {
+		t.Fatal("Expected an error for an escaped closing quote")
+	}
+}
+
+func TestParseCompositeNested(t *testing.T) {
+	const metadata = `(00000000-0000-0000-0000-000000000001,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`
+	src := `(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,admin,"(00000000-0000-0000-0000-000000000001,""2020-01-02 03:04:05+00"",""2020-01-02 03:04:05+00"",)")`
+	parts, err := parseComposite(src)
+	if err != nil {
+		t.Fatalf("Error parsing %s: %s", src, err)
+	}
+	if len(parts) != 4 || parts[3] != str(metadata) {
+		t.Fatalf("Expected the nested metadata as a single field, got %v", parts)
+	}
+
+	// As returned by `array_agg` of the memberships: one more quoting level.
+	agg := `{"(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,admin,\"(00000000-0000-0000-0000-000000000001,\"\"2020-01-02 03:04:05+00\"\",\"\"2020-01-02 03:04:05+00\"\",)\")",` +
+		`"(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000c,member,\"(,\"\"2020-01-02 03:04:05+00\"\",\"\"2020-01-02 03:04:05+00\"\",\"\"2020-01-03 03:04:05+00\"\")\")"}`
+	var uos UserOrganizations
+	if err := uos.Scan([]byte(agg)); err != nil {
+		t.Fatalf("Error scanning %s: %s", agg, err)
+	}
+	if len(uos) != 2 {
+		t.Fatalf("Expected 2 memberships, got %v", uos)
+	}
+	if uos[0].Role != RoleAdmin || uos[0].Metadata.Owner == nil || uos[0].Metadata.IsDeleted() {
+		t.Fatalf("Unexpected first membership %+v", uos[0])
+	}
+	if uos[1].Role != RoleMember || uos[1].Metadata.Owner != nil || !uos[1].Metadata.IsDeleted() {
+		t.Fatalf("Unexpected second membership %+v", uos[1])
+	}
+}
+
+func TestScanToBytes(t *testing.T) {
+	src := []byte("(a,b)")
+	b, err := scanToBytes(src)
+	if err != nil || &b[0] != &src[0] {
+		t.Fatalf("Expected the driver bytes without copy, got %q (%v)", b, err)
+	}
+	for _, src := range []interface{}{"(a,b)", sql.RawBytes("(a,b)"), stringer("(a,b)")} {
+		if b, err := scanToBytes(src); err != nil || string(b) != "(a,b)" {
+			t.Fatalf("%T: unexpected bytes %q (%v)", src, b, err)
+		}
+	}
+	if _, err := scanToBytes(42); !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("Expected ErrInvalidType, got %v", err)
+	}
+}
+
+// benchmarkRows is a 10k rows result set of memberships, as scanned from the driver.
+var benchmarkRows = func() [][]byte {
+	rows := make([][]byte, 10000)
+	for i := range rows {
+		rows[i] = []byte(`(00000000-0000-0000-0000-000000000001,00000000-0000-0000-0000-000000000002,admin,"(,""2020-01-02 03:04:05+00"",""2020-01-02 03:04:05+00"",)")`)
+	}
+	return rows
+}()
+
+func BenchmarkParseCompositeBytes(b *testing.B) {
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, row := range benchmarkRows {
+				src, err := scanToBytes(row)
+				if err != nil {
+					b.Fatalf("Unexpected error: %s", err)
+				}
+				if _, err := parseCompositeBytes(src); err != nil {
+					b.Fatalf("Error parsing %s: %s", src, err)
+				}
+			}
+		}
+	})
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, row := range benchmarkRows {
+				src, err := ScanToString(row)
+				if err != nil {
+					b.Fatalf("Unexpected error: %s", err)
+				}
+				if _, err := parseComposite(src); err != nil {
+					b.Fatalf("Error parsing %s: %s", src, err)
+				}
+			}
+		}
+	})
+}
+
+// nullValuer is a driver.Valuer of a NULL value.
+type nullValuer struct{}
+
+func (nullValuer) Value() (driver.Value, error) { return nil, nil }
+
+func TestCompositeLiteral(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	for _, tc := range []struct {
+		v      driver.Valuer
+		expect string
+	}{
+		{
+			Metadata{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}},
+			`'(,2020-01-02T03:04:05.000000Z,2020-01-02T03:04:05.000000Z,)'`,
+		},
+		{
+			Metadata{Owner: &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")}, TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}},
+			`'(00000000-0000-0000-0000-000000000001,2020-01-02T03:04:05.000000Z,2020-01-02T03:04:05.000000Z,)'`,
+		},
+		{
+			&PaymentPlan{ID: MustParseUUID("00000000-0000-0000-0000-000000000002"), Name: "o'brien, inc", Cost: 1, Currency: "USD", Term: TermMonthly, Metadata: Metadata{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}}},
+			`'(00000000-0000-0000-0000-000000000002,"o''brien, inc",1,USD,Monthly,,2020-01-02T03:04:05.000000Z,2020-01-02T03:04:05.000000Z,)'`,
+		},
+		{nullValuer{}, `NULL`},
+	} {
+		got, err := CompositeLiteral(tc.v)
+		if err != nil {
+			t.Fatalf("Error building the literal of %v: %s", tc.v, err)
+		}
+		if got != tc.expect {
+			t.Fatalf("Unexpected literal %s, expected %s", got, tc.expect)
+		}
+	}
+
+	if _, err := CompositeLiteral(UserOrganization{}); err == nil {
+		t.Fatal("Expected the Value error to be returned")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseCurrency(t *testing.T) {
+	for s, expect := range map[string]string{"USD": "USD", "usd": "USD", " eur ": "EUR"} {
+		code, err := ParseCurrency(s)
+		if err != nil || code != expect {
+			t.Fatalf("%q: expected %s, got %q, %v", s, expect, code, err)
+		}
+	}
+	for _, s := range []string{"", "XXX", "US"} {
+		if _, err := ParseCurrency(s); errors.Cause(err) != ErrInvalidCurrency {
+			t.Fatalf("%q: expected ErrInvalidCurrency, got %v", s, err)
+		}
+	}
+}
+
+func TestPaymentPlanFormattedCost(t *testing.T) {
+	for _, tc := range []struct {
+		cost     float64
+		currency string
+		expect   string
+	}{
+		{19.99, "USD", "19.99 USD"},
+		{19.99, "usd", "19.99 USD"},
+		{5, "EUR", "5.00 EUR"},
+		{1000, "jpy", "1000 JPY"},
+		{1.5, "kwd", "1.500 KWD"},
+		{1.5, "xxx", "1.50 XXX"},
+	} {
+		pp := PaymentPlan{Cost: tc.cost, Currency: tc.currency}
+		if got := pp.FormattedCost(); got != tc.expect {
+			t.Fatalf("%v %s: expected %q, got %q", tc.cost, tc.currency, tc.expect, got)
+		}
+	}
+}
+
+func TestPaymentPlanValidateCurrency(t *testing.T) {
+	for _, currency := range []string{"", "US$", "XXX"} {
+		err := NewPaymentPlan("pro", 1, currency, TermMonthly).Validate()
+		if err == nil || !strings.Contains(err.Error(), "currency") {
+			t.Fatalf("%q: expected an invalid currency, got %v", currency, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+// Cursor is an opaque pagination position: the base64 encoded (created_at, user_id) of the last seen user.
+// The empty Cursor starts from the first page when passed, and means there is no more page when returned.
+type Cursor string
+
+// cursorPosition is the decoded Cursor.
+type cursorPosition struct {
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+// newCursor returns the Cursor positioned right after the given user.
+func newCursor(u *User) (Cursor, error) {
+	buf, err := json.Marshal(cursorPosition{CreatedAt: u.Metadata.CreatedAt.Time(), UserID: u.ID})
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding cursor")
+	}
+	return Cursor(base64.RawURLEncoding.EncodeToString(buf)), nil
+}
+
+// decode returns the position of the cursor.
+func (c Cursor) decode() (cursorPosition, error) {
+	pos := cursorPosition{}
+	buf, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return pos, errors.Wrap(err, "invalid cursor encoding")
+	}
+	if err := json.Unmarshal(buf, &pos); err != nil {
+		return pos, errors.Wrap(err, "invalid cursor")
+	}
+	if pos.UserID == nil {
+		return pos, errors.New("invalid cursor user_id")
+	}
+	return pos, nil
+}
+
+// ListUsers returns up to limit users, ordered by creation, starting after the given cursor.
+// The returned Cursor points to the next page and is empty on the last page.
+func (r *UserRepository) ListUsers(ctx context.Context, cursor Cursor, limit int) ([]*User, Cursor, error) {
+	if limit <= 0 {
+		return nil, "", errors.Errorf("invalid limit %d", limit)
+	}
+
+	// Fetch one extra user to know whether there is a next page.
+	q := UserQuery{OrderBy: "u.created_at, u.user_id", Limit: limit + 1}
+	var args []interface{}
+	if cursor != "" {
+		pos, err := cursor.decode()
+		if err != nil {
+			return nil, "", err
+		}
+		q.Where = "(u.created_at, u.user_id) > (?, ?)"
+		args = append(args, pos.CreatedAt, pos.UserID)
+	}
+
+	users, err := r.selectUsers(ctx, q, args...)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error list users")
+	}
+	if len(users) <= limit {
+		return users, "", nil
+	}
+	users = users[:limit]
+	next, err := newCursor(users[limit-1])
+	if err != nil {
+		return nil, "", err
+	}
+	return users, next, nil
+}
+
+// EachUser streams all the users, ordered by creation, calling fn for each of them
+// as the rows are read, without loading the whole set in memory.
+// The iteration stops at the first error from fn, which is returned as is.
+// Neither the repository WithTimeout nor DefaultQueryTimeout applies, as the iteration lasts as long as fn takes:
+// it is bounded by ctx only or, when set, by its WithQueryTimeout for the whole iteration.
+func (r *UserRepository) EachUser(ctx context.Context, fn func(*User) error) error {
+	q := UserQuery{OrderBy: "u.created_at, u.user_id", IncludeDeleted: r.includeDeleted}
+
+	ctx, cancel := r.streamContext(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryxContext(ctx, r.db.Rebind(q.String()))
+	if err != nil {
+		return errors.Wrap(err, "error query users")
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		u := &userRecord{}
+		if err := rows.StructScan(u); err != nil {
+			return errors.Wrap(err, "error scan user")
+		}
+		if err := fn(u.toUser()); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(rows.Err(), "error iterate users")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/creack/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	u := &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")}
+	u.Metadata.CreatedAt = Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC))
+
+	c, err := newCursor(u)
+	if err != nil {
+		t.Fatalf("Error encoding cursor: %s", err)
+	}
+	pos, err := c.decode()
+	if err != nil {
+		t.Fatalf("Error decoding cursor %s: %s", c, err)
+	}
+	if !pos.CreatedAt.Equal(u.Metadata.CreatedAt.Time()) || !uuid.Equal(pos.UserID, u.ID) {
+		t.Fatalf("Unexpected position %v", pos)
+	}
+
+	for _, c := range []Cursor{"!", "bm9wZQ", "e30"} {
+		if _, err := c.decode(); err == nil {
+			t.Fatalf("Expected an error decoding %q", c)
+		}
+	}
+}
+
+func TestListUsersPages(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+
+	// Users sharing a created_at are ordered by user_id.
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	seeded := map[string]bool{}
+	for i := 0; i < 7; i++ {
+		u := NewUser()
+		u.Metadata.CreatedAt = Timestamp(ts.Time().Add(time.Duration(i/2) * time.Second))
+		if err := r.Insert(ctx, u); err != nil {
+			t.Fatalf("Error inserting user: %s", err)
+		}
+		seeded[u.ID.String()] = true
+	}
+
+	seen := map[string]bool{}
+	var cursor Cursor
+	for page := 0; ; page++ {
+		users, next, err := r.ListUsers(ctx, cursor, 3)
+		if err != nil {
+			t.Fatalf("Error listing page %d: %s", page, err)
+		}
+		for _, u := range users {
+			if seen[u.ID.String()] {
+				t.Fatalf("Duplicate user %s on page %d", u.ID, page)
+			}
+			seen[u.ID.String()] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	// The schema seeds the uuid_nil user as well, so only the inserted users are checked.
+	for id := range seeded {
+		if !seen[id] {
+			t.Fatalf("Missing user %s", id)
+		}
+	}
+	if _, _, err := r.ListUsers(ctx, "", 0); err == nil {
+		t.Fatal("Expected an error for a zero limit")
+	}
+}
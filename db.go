@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Connect opens a postgres connection and verifies it with a ping.
+// An already canceled or expired context returns its error right away.
+func Connect(ctx context.Context, dsn string) (*sqlx.DB, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "error connect to db")
+	}
+	db, err := sqlx.ConnectContext(ctx, "postgres", dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "error connect to db")
+	}
+	return db, nil
+}
+
+// NewDB connects to the database at the given dsn, i.e. `postgres://user@host:5432/db?sslmode=disable`.
+// An empty dsn defaults to the DATABASE_URL environment variable.
+func NewDB(ctx context.Context, dsn string) (*sqlx.DB, error) {
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_URL")
+	}
+	if dsn == "" {
+		return nil, errors.New("missing dsn: pass one or set DATABASE_URL")
+	}
+	return connect(ctx, dsn)
+}
+
+// Constraint violation errors, see wrapPQError.
+var (
+	ErrDuplicate  = errors.New("duplicate")
+	ErrForeignKey = errors.New("foreign key violation")
+	ErrNotNull    = errors.New("not null violation")
+)
+
+// wrapPQError maps the postgres unique, foreign key and not null violations
+// to ErrDuplicate, ErrForeignKey and ErrNotNull, annotated with the violated constraint or column.
+// Other errors are returned as is.
+func wrapPQError(err error) error {
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	if !ok {
+		return err
+	}
+	switch pqErr.Code {
+	case "23505":
+		return errors.Wrapf(ErrDuplicate, "%s (constraint %s)", pqErr.Message, pqErr.Constraint)
+	case "23503":
+		return errors.Wrapf(ErrForeignKey, "%s (constraint %s)", pqErr.Message, pqErr.Constraint)
+	case "23502":
+		return errors.Wrapf(ErrNotNull, "%s (column %s)", pqErr.Message, pqErr.Column)
+	default:
+		return err
+	}
+}
+
+// connect is the Connect used by NewDB and ConnectWithRetry, swapped in tests.
+var connect = Connect
+
+// maxRetryBackoff caps the ConnectWithRetry backoff.
+const maxRetryBackoff = 30 * time.Second
+
+// ConnectWithRetry connects like Connect, retrying up to attempts times in total
+// with an exponential backoff from base, capped to maxRetryBackoff, with jitter, i.e. while the database is starting.
+// The context cancellation interrupts the backoff. The last error is returned wrapped with the attempt count.
+func ConnectWithRetry(ctx context.Context, dsn string, attempts int, base time.Duration) (*sqlx.DB, error) {
+	if attempts < 1 {
+		return nil, errors.Errorf("invalid attempts %d", attempts)
+	}
+	if base <= 0 {
+		return nil, errors.Errorf("invalid base backoff %s", base)
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(retryBackoff(base, i))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, errors.Wrapf(ctx.Err(), "error connect to db after %d attempts, last error: %v", i, err)
+			case <-timer.C:
+			}
+		}
+		var db *sqlx.DB
+		if db, err = connect(ctx, dsn); err == nil {
+			return db, nil
+		}
+	}
+	return nil, errors.Wrapf(err, "error connect to db after %d attempts", attempts)
+}
+
+// retryBackoff returns the jittered delay before the given retry, from 1:
+// between half and the full `base * 2^(retry-1)`, capped to maxRetryBackoff.
+// The doubling stops at the cap, so a large retry count cannot overflow.
+func retryBackoff(base time.Duration, retry int) time.Duration {
+	backoff := base
+	for i := 1; i < retry && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// repository holds the settings shared by the repositories.
+// Every repository method honors the passed context: callers are expected
+// to supply a deadline, or to set one for all calls with WithTimeout.
+type repository struct {
+	db             *sqlx.DB
+	timeout        time.Duration
+	includeDeleted bool
+	dryRun         io.Writer
+}
+
+// RepositoryOption configures a repository.
+type RepositoryOption func(*repository)
+
+// WithTimeout bounds each repository call with the given timeout, except the EachUser stream.
+// A sooner deadline from the passed context still applies.
+func WithTimeout(d time.Duration) RepositoryOption {
+	return func(r *repository) {
+		r.timeout = d
+	}
+}
+
+// WithDeleted makes the repository fetches return the soft-deleted rows as well.
+// By default, they are filtered out.
+func WithDeleted() RepositoryOption {
+	return func(r *repository) {
+		r.includeDeleted = true
+	}
+}
+
+// WithDryRun makes the repository writes print their query and arguments to w instead of executing them,
+// for debugging. The reads are still executed.
+func WithDryRun(w io.Writer) RepositoryOption {
+	return func(r *repository) {
+		r.dryRun = w
+	}
+}
+
+// newRepository instantiates the shared repository settings.
+func newRepository(db *sqlx.DB, opts ...RepositoryOption) repository {
+	r := repository{db: db}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
+}
+
+// DefaultQueryTimeout bounds the repository calls without a timeout
+// from WithQueryTimeout or WithTimeout. 0 means no limit.
+var DefaultQueryTimeout = 30 * time.Second
+
+// queryTimeoutKey is the context key of the WithQueryTimeout timeout.
+type queryTimeoutKey struct{}
+
+// WithQueryTimeout returns a copy of ctx bounding each repository call made with it to the given timeout,
+// taking precedence over the repository WithTimeout and DefaultQueryTimeout.
+func WithQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutKey{}, d)
+}
+
+// queryTimeout returns the timeout of a repository call made with the given context:
+// the WithQueryTimeout one if any, else the repository one, else DefaultQueryTimeout.
+func (r *repository) queryTimeout(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(queryTimeoutKey{}).(time.Duration); ok {
+		return d
+	}
+	if r.timeout > 0 {
+		return r.timeout
+	}
+	return DefaultQueryTimeout
+}
+
+// context returns the context for a repository call, bounded by queryTimeout.
+// The returned cancel func must always be called.
+func (r *repository) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := r.queryTimeout(ctx)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// streamContext returns the context for a streaming repository call, which may outlast any per-query timeout.
+// Only an explicit WithQueryTimeout bounds it: the repository WithTimeout and DefaultQueryTimeout are not applied.
+// The returned cancel func must always be called.
+func (r *repository) streamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d, ok := ctx.Value(queryTimeoutKey{}).(time.Duration); ok && d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// ext returns the db the repository writes go through: the db itself or, with WithDryRun, a dryRunDB.
+func (r *repository) ext() sqlx.ExtContext {
+	if r.dryRun != nil {
+		return dryRunDB{ExtContext: r.db, w: r.dryRun}
+	}
+	return r.db
+}
+
+// dryRunDB prints the executed statements instead of executing them, see WithDryRun.
+// The read queries go through the embedded db and are still executed.
+type dryRunDB struct {
+	sqlx.ExtContext
+	w io.Writer
+}
+
+// ExecContext prints the given statement along with its arguments and reports no affected row.
+func (db dryRunDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := printQuery(db.w, query, args...); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// printQuery writes the given query followed by its arguments as SQL comments, i.e. `-- $1 = 'member'`.
+func printQuery(w io.Writer, query string, args ...interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteString(strings.TrimSpace(query) + "\n")
+	for i, arg := range args {
+		fmt.Fprintf(&buf, "-- $%d = %s\n", i+1, formatQueryArg(arg))
+	}
+	buf.WriteString("\n")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "error print query")
+	}
+	return nil
+}
+
+// formatQueryArg formats a query argument the way it would read in SQL:
+// NULL, a bare number or boolean, or a single-quoted string, uuid, timestamp or composite.
+func formatQueryArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case uuid.UUID:
+		if v == nil {
+			return "NULL"
+		}
+		return "'" + v.String() + "'"
+	case time.Time:
+		return "'" + Timestamp(v).String() + "'"
+	case *time.Time:
+		if v == nil {
+			return "NULL"
+		}
+		return formatQueryArg(*v)
+	case *Timestamp:
+		if v == nil {
+			return "NULL"
+		}
+		return formatQueryArg(*v)
+	case driver.Valuer:
+		val, err := v.Value()
+		if err != nil {
+			return fmt.Sprintf("<error: %v>", err)
+		}
+		return formatQueryArg(val)
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	case []byte:
+		return formatQueryArg(string(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
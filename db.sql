@@ -12,7 +12,7 @@ DROP TABLE IF EXISTS user_team_join         CASCADE;
 CREATE TABLE users (
   user_id  UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
 
-  owner_id   UUID                     NOT NULL REFERENCES users(user_id),
+  owner_id   UUID                              REFERENCES users(user_id),
   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
   deleted_at TIMESTAMP WITH TIME ZONE
@@ -27,11 +27,42 @@ CREATE TABLE organizations (
   deleted_at TIMESTAMP WITH TIME ZONE
 );
 
+-- The cost is stored as an integer number of the currency minor units, i.e. cents, to avoid rounding drift.
+CREATE TABLE payment_plans (
+  payment_plan_id UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+
+  name       VARCHAR NOT NULL,
+  cost_minor BIGINT  NOT NULL,
+  currency   CHAR(3) NOT NULL,
+  term       VARCHAR NOT NULL,
+
+  owner_id   UUID                              REFERENCES users(user_id),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A NULL or 0 capacity means no limit.
+CREATE TABLE teams (
+  team_id         UUID NOT NULL PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(organization_id),
+
+  name     VARCHAR NOT NULL,
+  capacity INTEGER          DEFAULT 0,
+
+  owner_id   UUID                              REFERENCES users(user_id),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT teams_organization_id_name_key UNIQUE (organization_id, name)
+);
+
 CREATE TABLE user_organization_join (
   organization_id UUID NOT NULL,
   user_id         UUID NOT NULL,
 
-  user_role VARCHAR NOT NULL DEFAULT 'user',
+  user_role VARCHAR NOT NULL DEFAULT 'member',
 
   owner_id   UUID                     NOT NULL REFERENCES users(user_id),
   created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
@@ -41,9 +72,23 @@ CREATE TABLE user_organization_join (
   PRIMARY KEY (organization_id, user_id)
 );
 
+CREATE TABLE user_team_join (
+  team_id UUID NOT NULL REFERENCES teams(team_id),
+  user_id UUID NOT NULL REFERENCES users(user_id),
+
+  user_role VARCHAR NOT NULL DEFAULT 'member',
+
+  owner_id   UUID                              REFERENCES users(user_id),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  deleted_at TIMESTAMP WITH TIME ZONE,
+
+  PRIMARY KEY (team_id, user_id)
+);
+
 -- Debug seed data.
 INSERT INTO users (user_id, owner_id) VALUES (uuid_nil(), uuid_nil());
 INSERT INTO organizations (organization_id, owner_id) VALUES (uuid_nil(), uuid_nil());
 
 INSERT INTO user_organization_join (organization_id, user_id, user_role, owner_id)
-VALUES (uuid_nil(), uuid_nil(), 'user', uuid_nil());
+VALUES (uuid_nil(), uuid_nil(), 'member', uuid_nil());
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// openTestDB connects to the TEST_DATABASE_URL database and resets its schema with db.sql.
+// As db.sql drops the tables, the tests needing a database are skipped unless it is explicitly set.
+func openTestDB(t testing.TB) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := NewDB(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("Error connecting to the test database: %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	schema, err := os.ReadFile("db.sql")
+	if err != nil {
+		t.Fatalf("Error reading the schema: %s", err)
+	}
+	db.MustExec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`)
+	db.MustExec(string(schema))
+	return db
+}
+
+// insertTestOrganization creates an organization owned by the seeded uuid_nil user.
+func insertTestOrganization(t testing.TB, db *sqlx.DB) *Organization {
+	t.Helper()
+
+	o := NewOrganization()
+	if _, err := db.Exec(db.Rebind(`INSERT INTO organizations (organization_id, owner_id) VALUES (?, ?)`), o.ID, NilUUID); err != nil {
+		t.Fatalf("Error inserting organization: %s", err)
+	}
+	return o
+}
+
+// testOwnerMetadata returns a metadata owned by the seeded uuid_nil user, as the memberships require an owner.
+func testOwnerMetadata() Metadata {
+	return Metadata{Owner: &User{ID: NilUUID}}
+}
+
+func TestConnectCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if _, err := Connect(ctx, "postgres://localhost:1/nope?sslmode=disable"); errors.Cause(err) != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected a prompt return, took %s", elapsed)
+	}
+}
+
+func TestRepositoryTimeout(t *testing.T) {
+	r := newRepository(nil, WithTimeout(time.Minute))
+	ctx, cancel := r.context(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("Expected the WithTimeout deadline, got %s", deadline)
+	}
+
+	// A sooner deadline from the passed context still applies.
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Second)
+	defer parentCancel()
+	ctx, cancel = r.context(parent)
+	defer cancel()
+	if deadline, _ := ctx.Deadline(); time.Until(deadline) > time.Second {
+		t.Fatalf("Expected the parent deadline, got %s", deadline)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	base := 10 * time.Millisecond
+	for retry, max := range map[int]time.Duration{1: base, 2: 2 * base, 3: 4 * base, 64: maxRetryBackoff, 1000: maxRetryBackoff} {
+		for i := 0; i < 100; i++ {
+			d := retryBackoff(base, retry)
+			if d < max/2 || d > max {
+				t.Fatalf("Retry %d: expected a backoff between %s and %s, got %s", retry, max/2, max, d)
+			}
+		}
+	}
+}
+
+func TestConnectWithRetry(t *testing.T) {
+	defer func(prev func(context.Context, string) (*sqlx.DB, error)) { connect = prev }(connect)
+	errDown := errors.New("db down")
+
+	calls := 0
+	connect = func(ctx context.Context, dsn string) (*sqlx.DB, error) {
+		if calls++; calls < 3 {
+			return nil, errDown
+		}
+		return &sqlx.DB{}, nil
+	}
+	if _, err := ConnectWithRetry(context.Background(), "dsn", 3, time.Millisecond); err != nil {
+		t.Fatalf("Expected success on the last attempt, got %s", err)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", calls)
+	}
+
+	calls = 0
+	_, err := ConnectWithRetry(context.Background(), "dsn", 2, time.Millisecond)
+	if errors.Cause(err) != errDown || calls != 2 {
+		t.Fatalf("Expected the last error after 2 attempts, got %v after %d", err, calls)
+	}
+
+	// A large attempt count must not overflow the backoff: the context ends the retries.
+	connect = func(ctx context.Context, dsn string) (*sqlx.DB, error) { return nil, errDown }
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ConnectWithRetry(ctx, "dsn", 1000, time.Millisecond); errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		attempts int
+		base     time.Duration
+	}{{0, time.Second}, {1, 0}, {1, -time.Second}} {
+		if _, err := ConnectWithRetry(context.Background(), "dsn", tc.attempts, tc.base); err == nil {
+			t.Fatalf("Expected an error for %d attempts from %s", tc.attempts, tc.base)
+		}
+	}
+}
+
+func TestRepositoryStreamContext(t *testing.T) {
+	r := &repository{timeout: time.Millisecond}
+
+	ctx, cancel := r.streamContext(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("Expected no deadline from the repository timeout")
+	}
+
+	ctx, cancel = r.streamContext(WithQueryTimeout(context.Background(), time.Minute))
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) < time.Minute-time.Second {
+		t.Fatalf("Expected the WithQueryTimeout deadline, got %s", deadline)
+	}
+
+	ctx, cancel = r.context(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		t.Fatal("Expected a deadline for a regular call")
+	}
+}
+
+func TestNewDBDSN(t *testing.T) {
+	defer func(prev func(context.Context, string) (*sqlx.DB, error)) { connect = prev }(connect)
+	var got string
+	connect = func(ctx context.Context, dsn string) (*sqlx.DB, error) {
+		got = dsn
+		return &sqlx.DB{}, nil
+	}
+
+	t.Setenv("DATABASE_URL", "postgres://env@localhost/db")
+	for _, tc := range []struct {
+		dsn, expect string
+	}{
+		{"", "postgres://env@localhost/db"},
+		{"postgres://explicit@localhost/db", "postgres://explicit@localhost/db"},
+	} {
+		if _, err := NewDB(context.Background(), tc.dsn); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if got != tc.expect {
+			t.Fatalf("Expected the dsn %s, got %s", tc.expect, got)
+		}
+	}
+
+	t.Setenv("DATABASE_URL", "")
+	got = ""
+	if _, err := NewDB(context.Background(), ""); err == nil || got != "" {
+		t.Fatalf("Expected an error without dsn, got %v (connected to %q)", err, got)
+	}
+}
+
+func TestWrapPQError(t *testing.T) {
+	for _, tc := range []struct {
+		err    *pq.Error
+		expect error
+		detail string
+	}{
+		{&pq.Error{Code: "23505", Message: "duplicate key", Constraint: "users_pkey"}, ErrDuplicate, "users_pkey"},
+		{&pq.Error{Code: "23503", Message: "foreign key", Constraint: "teams_organization_id_fkey"}, ErrForeignKey, "teams_organization_id_fkey"},
+		{&pq.Error{Code: "23502", Message: "null value", Column: "owner_id"}, ErrNotNull, "owner_id"},
+	} {
+		// The driver error may already be wrapped.
+		err := wrapPQError(errors.Wrap(tc.err, "error insert"))
+		if errors.Cause(err) != tc.expect {
+			t.Fatalf("%s: expected %v, got %v", tc.err.Code, tc.expect, err)
+		}
+		if !strings.Contains(err.Error(), tc.detail) {
+			t.Fatalf("%s: expected %q in %q", tc.err.Code, tc.detail, err)
+		}
+	}
+
+	for _, err := range []error{&pq.Error{Code: "42P01"}, errors.New("not a pq error")} {
+		if got := wrapPQError(err); got != err {
+			t.Fatalf("Expected %v to be returned as is, got %v", err, got)
+		}
+	}
+	if wrapPQError(nil) != nil {
+		t.Fatal("Expected a nil error to stay nil")
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	defer func(prev time.Duration) { DefaultQueryTimeout = prev }(DefaultQueryTimeout)
+	DefaultQueryTimeout = time.Hour
+
+	for _, tc := range []struct {
+		name   string
+		r      repository
+		ctx    context.Context
+		expect time.Duration
+	}{
+		{"default", newRepository(nil), context.Background(), time.Hour},
+		{"repository", newRepository(nil, WithTimeout(time.Minute)), context.Background(), time.Minute},
+		{"context", newRepository(nil, WithTimeout(time.Minute)), WithQueryTimeout(context.Background(), time.Second), time.Second},
+		{"unbounded context", newRepository(nil), WithQueryTimeout(context.Background(), 0), 0},
+	} {
+		if got := tc.r.queryTimeout(tc.ctx); got != tc.expect {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.expect, got)
+		}
+		ctx, cancel := tc.r.context(tc.ctx)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if ok != (tc.expect > 0) {
+			t.Fatalf("%s: unexpected deadline %s (%t)", tc.name, deadline, ok)
+		}
+		if ok && time.Until(deadline) > tc.expect {
+			t.Fatalf("%s: expected a deadline within %s, got %s", tc.name, tc.expect, deadline)
+		}
+	}
+
+	DefaultQueryTimeout = 0
+	r := newRepository(nil)
+	ctx, cancel := r.context(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("Expected no deadline without any timeout")
+	}
+}
+
+func TestPrintQuery(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	err := printQuery(&buf, "\nINSERT INTO t VALUES ($1, $2, $3, $4, $5, $6, $7)\n",
+		MustParseUUID("00000000-0000-0000-0000-000000000001"),
+		nil,
+		ts,
+		(*Timestamp)(nil),
+		"o'brien",
+		Metadata{TimeMetadata: TimeMetadata{CreatedAt: Timestamp(ts), UpdatedAt: Timestamp(ts)}},
+		42,
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	const expect = `INSERT INTO t VALUES ($1, $2, $3, $4, $5, $6, $7)
+-- $1 = '00000000-0000-0000-0000-000000000001'
+-- $2 = NULL
+-- $3 = '2020-01-02T03:04:05.000000Z'
+-- $4 = NULL
+-- $5 = 'o''brien'
+-- $6 = '(,2020-01-02T03:04:05.000000Z,2020-01-02T03:04:05.000000Z,)'
+-- $7 = 42
+
+`
+	if buf.String() != expect {
+		t.Fatalf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+}
+
+func TestDryRunInsert(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewUserRepository(sqlx.NewDb(nil, "postgres"), WithDryRun(&buf))
+	u := &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")}
+	if err := r.Insert(context.Background(), u); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, line := range []string{"INSERT INTO users (", "  $1,\n", "-- $1 = '00000000-0000-0000-0000-000000000001'\n", "-- $5 = NULL\n"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("Missing %q in:\n%s", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/creack/uuid"
+)
+
+// FieldChange is a field level difference between two versions of a model.
+// Path is the JSON path of the field, memberships being keyed by organization id and team memberships by team id,
+// i.e. `organization_memberships[<organization_id>].role`, `team_memberships[<team_id>].role`.
+// Old is nil for an addition and New is nil for a removal.
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// DiffUser returns the field level changes between the old and new versions of a user,
+// covering the scalar fields, the payment plan and the membership additions, removals and role changes.
+// The membership changes are ordered by organization or team id. A nil user is treated as an empty one.
+func DiffUser(old, new *User) []FieldChange {
+	if old == nil {
+		old = &User{}
+	}
+	if new == nil {
+		new = &User{}
+	}
+
+	d := differ{}
+	d.uuid("user_id", old.ID, new.ID)
+	d.metadata("metadata", old.Metadata, new.Metadata)
+	d.paymentPlan("payment_plan", old.PaymentPlan, new.PaymentPlan)
+
+	oldOrgs, newOrgs := map[string]membershipDiff{}, map[string]membershipDiff{}
+	for _, uo := range old.Organizations {
+		oldOrgs[uo.OrganizationID.String()] = membershipDiff{value: uo, role: uo.Role, metadata: uo.Metadata}
+	}
+	for _, uo := range new.Organizations {
+		newOrgs[uo.OrganizationID.String()] = membershipDiff{value: uo, role: uo.Role, metadata: uo.Metadata}
+	}
+	d.memberships("organization_memberships", oldOrgs, newOrgs)
+
+	// A user may be in several teams of a same organization: the team memberships are keyed by team.
+	oldTeams, newTeams := map[string]membershipDiff{}, map[string]membershipDiff{}
+	for _, ut := range old.Teams {
+		oldTeams[teamMembershipKey(ut)] = membershipDiff{value: ut, role: ut.Role, metadata: ut.Metadata}
+	}
+	for _, ut := range new.Teams {
+		newTeams[teamMembershipKey(ut)] = membershipDiff{value: ut, role: ut.Role, metadata: ut.Metadata}
+	}
+	d.memberships("team_memberships", oldTeams, newTeams)
+
+	return d.changes
+}
+
+// membershipDiff holds the compared fields of a UserOrganization or a UserTeam.
+type membershipDiff struct {
+	value    interface{}
+	role     Role
+	metadata Metadata
+}
+
+// differ accumulates field changes.
+type differ struct {
+	changes []FieldChange
+}
+
+func (d *differ) add(path string, old, new interface{}) {
+	d.changes = append(d.changes, FieldChange{Path: path, Old: old, New: new})
+}
+
+func (d *differ) uuid(path string, old, new uuid.UUID) {
+	if !uuid.Equal(old, new) {
+		d.add(path, old, new)
+	}
+}
+
+func (d *differ) time(path string, old, new Timestamp) {
+	if !old.Equal(new) {
+		d.add(path, old, new)
+	}
+}
+
+func (d *differ) metadata(path string, old, new Metadata) {
+	var oldOwner, newOwner uuid.UUID
+	if old.Owner != nil {
+		oldOwner = old.Owner.ID
+	}
+	if new.Owner != nil {
+		newOwner = new.Owner.ID
+	}
+	d.uuid(joinPath(path, "owner_id"), oldOwner, newOwner)
+	var oldCreator, newCreator uuid.UUID
+	if old.CreatedBy != nil {
+		oldCreator = old.CreatedBy.ID
+	}
+	if new.CreatedBy != nil {
+		newCreator = new.CreatedBy.ID
+	}
+	d.uuid(joinPath(path, "created_by"), oldCreator, newCreator)
+	d.time(joinPath(path, "created_at"), old.CreatedAt, new.CreatedAt)
+	d.time(joinPath(path, "updated_at"), old.UpdatedAt, new.UpdatedAt)
+	if !equalTimePtr(old.DeletedAt, new.DeletedAt) {
+		d.add(joinPath(path, "deleted_at"), old.DeletedAt, new.DeletedAt)
+	}
+}
+
+func (d *differ) paymentPlan(path string, old, new *PaymentPlan) {
+	switch {
+	case old == nil && new == nil:
+		return
+	case old == nil:
+		d.add(path, nil, new)
+		return
+	case new == nil:
+		d.add(path, old, nil)
+		return
+	}
+	d.uuid(joinPath(path, "payment_plan_id"), old.ID, new.ID)
+	if old.Name != new.Name {
+		d.add(joinPath(path, "name"), old.Name, new.Name)
+	}
+	if old.Cost != new.Cost {
+		d.add(joinPath(path, "cost"), old.Cost, new.Cost)
+	}
+	if old.Currency != new.Currency {
+		d.add(joinPath(path, "currency"), old.Currency, new.Currency)
+	}
+	if old.Term != new.Term {
+		d.add(joinPath(path, "term"), old.Term, new.Term)
+	}
+	d.metadata(path, old.Metadata, new.Metadata)
+}
+
+// teamMembershipKey returns the diff key of the given team membership: its team id
+// or, for a membership loaded without it, its organization id.
+func teamMembershipKey(ut UserTeam) string {
+	if ut.TeamID != nil {
+		return ut.TeamID.String()
+	}
+	return ut.OrganizationID.String()
+}
+
+// memberships diffs the given memberships keyed by organization or team id, in key order.
+func (d *differ) memberships(path string, old, new map[string]membershipDiff) {
+	keys := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		elemPath := path + "[" + k + "]"
+		o, inOld := old[k]
+		n, inNew := new[k]
+		switch {
+		case !inOld:
+			d.add(elemPath, nil, n.value)
+		case !inNew:
+			d.add(elemPath, o.value, nil)
+		default:
+			if o.role != n.role {
+				d.add(joinPath(elemPath, "role"), o.role, n.role)
+			}
+			d.metadata(joinPath(elemPath, "metadata"), o.metadata, n.metadata)
+		}
+	}
+}
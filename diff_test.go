@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestDiffUserTeamsOfSameOrganization(t *testing.T) {
+	orgID := MustParseUUID("00000000-0000-0000-0000-00000000000b")
+	team1 := UserTeam{OrganizationID: orgID, TeamID: MustParseUUID("00000000-0000-0000-0000-000000000001"), Role: RoleMember}
+	team2 := UserTeam{OrganizationID: orgID, TeamID: MustParseUUID("00000000-0000-0000-0000-000000000002"), Role: RoleMember}
+
+	old := &User{Teams: []UserTeam{team1, team2}}
+	promoted := team2
+	promoted.Role = RoleAdmin
+	new := &User{Teams: []UserTeam{team1, promoted}}
+
+	changes := DiffUser(old, new)
+	if len(changes) != 1 {
+		t.Fatalf("Expected a single change, got %v", changes)
+	}
+	if expect := "team_memberships[" + team2.TeamID.String() + "].role"; changes[0].Path != expect {
+		t.Fatalf("Expected a change of %s, got %s", expect, changes[0].Path)
+	}
+
+	// Removing one of the teams does not hide the other one.
+	changes = DiffUser(old, &User{Teams: []UserTeam{team1}})
+	if len(changes) != 1 || changes[0].New != nil {
+		t.Fatalf("Expected the removal of the second team, got %v", changes)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"github.com/creack/uuid"
+)
+
+// Equal reports whether both users hold the same values.
+// UUIDs are compared by value, timestamps with Timestamp.Equal
+// and the membership slices regardless of their order.
+// Owners are compared by id only.
+func (u *User) Equal(other *User) bool {
+	if u == nil || other == nil {
+		return u == other
+	}
+	return uuid.Equal(u.ID, other.ID) &&
+		u.Organizations.Equal(other.Organizations) &&
+		equalUnordered(len(u.Teams), len(other.Teams), func(i, j int) bool {
+			return u.Teams[i].Equal(&other.Teams[j])
+		}) &&
+		u.PaymentPlan.Equal(other.PaymentPlan) &&
+		u.Metadata.Equal(other.Metadata)
+}
+
+// Equal reports whether both slices hold the same memberships, regardless of their order.
+func (uos UserOrganizations) Equal(other UserOrganizations) bool {
+	return equalUnordered(len(uos), len(other), func(i, j int) bool {
+		return uos[i].Equal(&other[j])
+	})
+}
+
+// Equal reports whether both memberships hold the same values. See User.Equal.
+func (uo *UserOrganization) Equal(other *UserOrganization) bool {
+	if uo == nil || other == nil {
+		return uo == other
+	}
+	return uuid.Equal(uo.UserID, other.UserID) &&
+		uuid.Equal(uo.OrganizationID, other.OrganizationID) &&
+		uo.Role == other.Role &&
+		uo.Metadata.Equal(other.Metadata)
+}
+
+// Equal reports whether both memberships hold the same values. See User.Equal.
+func (ut *UserTeam) Equal(other *UserTeam) bool {
+	if ut == nil || other == nil {
+		return ut == other
+	}
+	return uuid.Equal(ut.UserID, other.UserID) &&
+		uuid.Equal(ut.OrganizationID, other.OrganizationID) &&
+		uuid.Equal(ut.TeamID, other.TeamID) &&
+		ut.Role == other.Role &&
+		ut.Metadata.Equal(other.Metadata)
+}
+
+// Equal reports whether both organizations hold the same values.
+// Users and teams are compared regardless of their order. See User.Equal.
+func (o *Organization) Equal(other *Organization) bool {
+	if o == nil || other == nil {
+		return o == other
+	}
+	return uuid.Equal(o.ID, other.ID) &&
+		equalUnordered(len(o.Users), len(other.Users), func(i, j int) bool {
+			return o.Users[i].Equal(other.Users[j])
+		}) &&
+		equalUnordered(len(o.Teams), len(other.Teams), func(i, j int) bool {
+			return o.Teams[i].Equal(other.Teams[j])
+		}) &&
+		o.PaymentPlan.Equal(other.PaymentPlan) &&
+		o.Metadata.Equal(other.Metadata)
+}
+
+// Equal reports whether both teams hold the same values.
+// Users are compared regardless of their order and the organization by id only. See User.Equal.
+func (t *Team) Equal(other *Team) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return uuid.Equal(t.ID, other.ID) &&
+		uuid.Equal(t.organizationID(), other.organizationID()) &&
+		t.Name == other.Name &&
+		t.Capacity == other.Capacity &&
+		t.CapacityNull == other.CapacityNull &&
+		equalUnordered(len(t.Users), len(other.Users), func(i, j int) bool {
+			return t.Users[i].Equal(other.Users[j])
+		}) &&
+		t.Metadata.Equal(other.Metadata)
+}
+
+// organizationID returns the id of the team organization, nil if none.
+func (t *Team) organizationID() uuid.UUID {
+	if t.Organization == nil {
+		return nil
+	}
+	return t.Organization.ID
+}
+
+// Equal reports whether both payment plans hold the same values. See User.Equal.
+func (pp *PaymentPlan) Equal(other *PaymentPlan) bool {
+	if pp == nil || other == nil {
+		return pp == other
+	}
+	return uuid.Equal(pp.ID, other.ID) &&
+		pp.Name == other.Name &&
+		pp.Cost == other.Cost &&
+		pp.Currency == other.Currency &&
+		pp.Term == other.Term &&
+		pp.Metadata.Equal(other.Metadata)
+}
+
+// Equal reports whether both metadata hold the same owner and creator ids and timestamps.
+func (m Metadata) Equal(other Metadata) bool {
+	return equalUserID(m.Owner, other.Owner) &&
+		equalUserID(m.CreatedBy, other.CreatedBy) &&
+		m.TimeMetadata.Equal(other.TimeMetadata)
+}
+
+// equalUserID reports whether both users are nil or have the same id.
+func equalUserID(u, other *User) bool {
+	if u == nil || other == nil {
+		return u == other
+	}
+	return uuid.Equal(u.ID, other.ID)
+}
+
+// Equal reports whether both hold the same instants.
+func (tm TimeMetadata) Equal(other TimeMetadata) bool {
+	return tm.CreatedAt.Equal(other.CreatedAt) &&
+		tm.UpdatedAt.Equal(other.UpdatedAt) &&
+		equalTimePtr(tm.DeletedAt, other.DeletedAt)
+}
+
+func equalTimePtr(a, b *Timestamp) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// equalUnordered reports whether each of the n elements of a slice
+// matches a distinct element out of the m elements of another one, using eq(i, j).
+func equalUnordered(n, m int, eq func(i, j int) bool) bool {
+	if n != m {
+		return false
+	}
+	matched := make([]bool, m)
+	for i := 0; i < n; i++ {
+		found := false
+		for j := 0; j < m; j++ {
+			if !matched[j] && eq(i, j) {
+				matched[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserEqualUnordered(t *testing.T) {
+	userID := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	org1 := MustParseUUID("00000000-0000-0000-0000-000000000002")
+	org2 := MustParseUUID("00000000-0000-0000-0000-000000000003")
+	uo1 := UserOrganization{UserID: userID, OrganizationID: org1, Role: RoleMember}
+	uo2 := UserOrganization{UserID: userID, OrganizationID: org2, Role: RoleAdmin}
+
+	a := &User{ID: userID, Organizations: UserOrganizations{uo1, uo2}}
+	b := &User{ID: MustParseUUID(userID.String()), Organizations: UserOrganizations{uo2, uo1}}
+	if !a.Equal(b) || !b.Equal(a) {
+		t.Fatal("Expected the reordered memberships to be equal")
+	}
+
+	promoted := uo1
+	promoted.Role = RoleAdmin
+	for _, other := range []*User{
+		{ID: userID, Organizations: UserOrganizations{uo1}},
+		{ID: userID, Organizations: UserOrganizations{uo1, uo1}},
+		{ID: userID, Organizations: UserOrganizations{promoted, uo2}},
+		{ID: org1, Organizations: UserOrganizations{uo1, uo2}},
+		nil,
+	} {
+		if a.Equal(other) {
+			t.Fatalf("Expected %v to differ from %v", other, a)
+		}
+	}
+	if !(*User)(nil).Equal(nil) {
+		t.Fatal("Expected nil users to be equal")
+	}
+}
+
+func TestTimeMetadataEqualLocation(t *testing.T) {
+	ts := Now()
+	other := Timestamp(ts.Time().In(time.FixedZone("EST", -5*60*60)))
+	if !(TimeMetadata{CreatedAt: ts}).Equal(TimeMetadata{CreatedAt: other}) {
+		t.Fatal("Expected the same instants in different locations to be equal")
+	}
+}
@@ -0,0 +1,13 @@
+module github.com/geplo/modeltest
+
+go 1.22
+
+require (
+	github.com/creack/uuid v0.0.0-00010101000000-000000000000
+	github.com/jmoiron/sqlx v1.4.0
+	github.com/lib/pq v1.12.3
+	github.com/pkg/errors v0.9.1
+)
+
+// github.com/creack/uuid is a fork of github.com/pborman/uuid, no longer published on its own.
+replace github.com/creack/uuid => github.com/pborman/uuid v0.0.0-20170612153648-e790cca94e6c
@@ -2,15 +2,17 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/creack/uuid"
-	"github.com/jmoiron/sqlx"
-	"github.com/lib/pq"
+	"github.com/lib/pq/hstore"
 	"github.com/pkg/errors"
 
 	_ "github.com/lib/pq"
@@ -18,35 +20,86 @@ import (
 
 // Common errors.
 var (
-	ErrInvalidType = errors.New("invalid type")
+	ErrInvalidType       = errors.New("invalid type")
+	ErrInvalidCount      = errors.New("invalid count")
+	ErrInvalidRole       = errors.New("invalid role")
+	ErrInvalidTerm       = errors.New("invalid term")
+	ErrInvalidCurrency   = errors.New("invalid currency")
+	ErrTeamFull          = errors.New("team is full")
+	ErrNotMember         = errors.New("not a member")
+	ErrAlreadyMember     = errors.New("already a member")
+	ErrDuplicateTeamName = errors.New("duplicate team name")
+	ErrMemberMismatch    = errors.New("membership of another user")
 )
 
 // ScanToString returns the string version of the given interface.
-// If not a `string` or a `[]byte`, returns ErrInvalidType.
+// If not a `string`, a `[]byte`, a `sql.RawBytes` or a `fmt.Stringer`, returns ErrInvalidType.
 func ScanToString(src interface{}) (string, error) {
 	switch s := src.(type) {
 	case string:
 		return s, nil
 	case []byte:
 		return string(s), nil
+	case sql.RawBytes:
+		return string(s), nil
+	case fmt.Stringer:
+		return s.String(), nil
 	default:
 		return "", ErrInvalidType
 	}
 }
 
+// scanToBytes is ScanToString without the copy of the driver `[]byte` and `sql.RawBytes` values,
+// for the scanners tokenizing their source right away. The returned bytes must not be retained.
+func scanToBytes(src interface{}) ([]byte, error) {
+	switch b := src.(type) {
+	case []byte:
+		return b, nil
+	case sql.RawBytes:
+		return b, nil
+	default:
+		s, err := ScanToString(src)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(s), nil
+	}
+}
+
+// ScanLocation is the location the scanned timestamps are parsed into.
+// Defaults to UTC.
+var ScanLocation = time.UTC
+
+// StrictScan makes the scanners validate the decoded models, see Validator,
+// and reject the questionable rows instead of accepting them, i.e. a payment plan with a negative cost
+// or a membership owned by a third party, neither its user nor its organization.
+// The unknown roles, terms and currencies are always rejected.
+// Defaults to false.
+var StrictScan = false
+
+// MarshalOwnerInline makes the metadata JSON embed the full `owner` object instead of its `owner_id`,
+// when the owner is fully loaded, i.e. by ResolveOwners. Stub owners, only carrying an id, are always flattened.
+// Defaults to false.
+var MarshalOwnerInline = false
+
 // TimeMetadata .
 type TimeMetadata struct {
-	CreatedAt time.Time  `json:"created_at"           db:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"           db:"updated_at"`
-	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	CreatedAt Timestamp  `json:"created_at"           db:"created_at"`
+	UpdatedAt Timestamp  `json:"updated_at"           db:"updated_at"`
+	DeletedAt *Timestamp `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
 // MarshalJSON implements json.Marshaler interface.
-func (tm *TimeMetadata) MarshalJSON() ([]byte, error) {
-	if tm == nil {
-		return nil, nil
-	}
-	mm := map[string]time.Time{}
+// The zero timestamps are omitted, so an empty TimeMetadata is the empty object `{}`,
+// whether encoded by value, i.e. as a struct field, or through a pointer.
+// The value receiver is what makes both cases go through it; encoding/json emits `null` for a nil pointer.
+func (tm TimeMetadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tm.jsonFields())
+}
+
+// jsonFields returns the non-zero timestamps.
+func (tm TimeMetadata) jsonFields() map[string]interface{} {
+	mm := map[string]interface{}{}
 	if !tm.CreatedAt.IsZero() {
 		mm["created_at"] = tm.CreatedAt
 	}
@@ -56,38 +109,70 @@ func (tm *TimeMetadata) MarshalJSON() ([]byte, error) {
 	if tm.DeletedAt != nil && !tm.DeletedAt.IsZero() {
 		mm["deleted_at"] = *tm.DeletedAt
 	}
-	if len(mm) == 0 {
-		return nil, nil
+	return mm
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// Absent keys leave the fields zero. A `null` body leaves tm untouched.
+// The timestamps are decoded into ScanLocation.
+func (tm *TimeMetadata) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
 	}
-	return json.Marshal(mm)
+	var mm struct {
+		CreatedAt Timestamp `json:"created_at"`
+		UpdatedAt Timestamp `json:"updated_at"`
+		DeletedAt Timestamp `json:"deleted_at"`
+	}
+	if err := json.Unmarshal(b, &mm); err != nil {
+		return errors.Wrap(err, "error decoding TimeMetadata")
+	}
+	*tm = TimeMetadata{
+		CreatedAt: mm.CreatedAt,
+		UpdatedAt: mm.UpdatedAt,
+	}
+	if !mm.DeletedAt.IsZero() {
+		tm.DeletedAt = &mm.DeletedAt
+	}
+	return nil
 }
 
 // Scan1 implements sql.Scan interface.
+// It reads a `(created_at,updated_at,deleted_at)` composite or, from a jsonb column, a JSON object.
 func (tm *TimeMetadata) Scan1(src interface{}) error {
-	s, err := ScanToString(src)
+	b, err := scanToBytes(src)
 	if err != nil {
 		return errors.Wrap(err, "invalid type for TimeMetadata scan")
 	}
-	s = strings.Trim(s, "()")
-	parts := strings.Split(s, ",")
-	if len(parts) != 3 {
-		return errors.New("invalid count for TimeMetadata scan")
+	if isJSONObject(b) {
+		if err := tm.UnmarshalJSON(b); err != nil {
+			return errors.Wrap(err, "error parsing TimeMetadata jsonb")
+		}
+		return nil
 	}
-	for i, part := range parts {
-		parts[i] = strings.Trim(part, `"`)
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing TimeMetadata composite")
 	}
+	return tm.scanFields(parts)
+}
 
-	tm.CreatedAt, err = pq.ParseTimestamp(time.UTC, parts[0])
-	if err != nil {
+// scanFields decodes the already tokenized `created_at,updated_at,deleted_at` fields.
+func (tm *TimeMetadata) scanFields(parts []sql.NullString) error {
+	if len(parts) != 3 {
+		return countError("TimeMetadata", 3, len(parts), joinComposite(parts))
+	}
+
+	if err := tm.CreatedAt.parse(parts[0].String); err != nil {
 		return errors.Wrap(err, "error parsing created_at")
 	}
-	tm.UpdatedAt, err = pq.ParseTimestamp(time.UTC, parts[1])
-	if err != nil {
+	if err := tm.UpdatedAt.parse(parts[1].String); err != nil {
 		return errors.Wrap(err, "error parsing updated_at")
 	}
-	if parts[2] != "" {
-		deletedAt, err := pq.ParseTimestamp(time.UTC, parts[2])
-		if err != nil {
+	tm.DeletedAt = nil
+	if parts[2].Valid {
+		var deletedAt Timestamp
+		if err := deletedAt.parse(parts[2].String); err != nil {
 			return errors.Wrap(err, "error parsing deleted_at")
 		}
 		tm.DeletedAt = &deletedAt
@@ -95,54 +180,288 @@ func (tm *TimeMetadata) Scan1(src interface{}) error {
 	return nil
 }
 
+// Value implements driver.Valuer interface.
+// It emits the `(created_at,updated_at,deleted_at)` composite expected by Scan1.
+func (tm TimeMetadata) Value() (driver.Value, error) {
+	return "(" + strings.Join(tm.compositeFields(), ",") + ")", nil
+}
+
+// compositeFields returns the encoded timestamp fields of the composite.
+// A nil DeletedAt is left empty.
+func (tm TimeMetadata) compositeFields() []string {
+	fields := []string{encodeTimestamp(tm.CreatedAt), encodeTimestamp(tm.UpdatedAt), ""}
+	if tm.DeletedAt != nil {
+		fields[2] = encodeTimestamp(*tm.DeletedAt)
+	}
+	return fields
+}
+
+// encodeTimestamp formats the given timestamp in its canonical form, as a composite field.
+func encodeTimestamp(t Timestamp) string {
+	return encodeCompositeField(t.String())
+}
+
+// IsDeleted returns true if the object is soft-deleted.
+func (tm *TimeMetadata) IsDeleted() bool {
+	return tm.DeletedAt != nil
+}
+
+// Delete soft-deletes the object by setting DeletedAt to now, in UTC.
+// Deleting an already deleted object keeps the original DeletedAt.
+func (tm *TimeMetadata) Delete() {
+	if tm.DeletedAt != nil {
+		return
+	}
+	now := Now()
+	tm.DeletedAt = &now
+}
+
+// Restore reverts a soft-delete.
+func (tm *TimeMetadata) Restore() {
+	tm.DeletedAt = nil
+}
+
+// Touch sets UpdatedAt to now, in UTC.
+// CreatedAt is initialized as well on the first touch.
+func (tm *TimeMetadata) Touch() {
+	now := Now()
+	if tm.CreatedAt.IsZero() {
+		tm.CreatedAt = now
+	}
+	tm.UpdatedAt = now
+}
+
 // Metadata .
+// Owner is the current owner of the object while the optional CreatedBy is its creator, which never changes.
 type Metadata struct {
 	Owner        *User `json:"owner,omitempty"`
+	CreatedBy    *User `json:"created_by,omitempty"`
 	TimeMetadata `json:",inline" db:"timemetadata"`
 }
 
+// IsDeleted returns true if the object is soft-deleted.
+func (m Metadata) IsDeleted() bool {
+	return m.TimeMetadata.IsDeleted()
+}
+
+// Touch bumps the UpdatedAt timestamp. See TimeMetadata.Touch.
+func (m *Metadata) Touch() {
+	m.TimeMetadata.Touch()
+}
+
+// SetOwner sets the owner to a user with the given id.
+// Nil and zero UUIDs are rejected, use ClearOwner instead.
+func (m *Metadata) SetOwner(id uuid.UUID) error {
+	if IsNil(id) {
+		return errors.New("invalid nil owner_id")
+	}
+	m.Owner = &User{ID: id}
+	return nil
+}
+
+// ClearOwner removes the owner.
+func (m *Metadata) ClearOwner() {
+	m.Owner = nil
+}
+
 // MarshalJSON implements json.Marshaler interface.
 func (m Metadata) MarshalJSON() ([]byte, error) {
-	mm := map[string]interface{}{}
-	if m.Owner != nil {
+	return json.Marshal(m.jsonFields())
+}
+
+// jsonFields returns the flattened JSON representation of the metadata.
+// The creator, if any, is emitted as its `created_by` id.
+func (m Metadata) jsonFields() map[string]interface{} {
+	mm := m.TimeMetadata.jsonFields()
+	switch {
+	case m.Owner == nil:
+	case MarshalOwnerInline && !m.Owner.Metadata.CreatedAt.IsZero():
+		mm["owner"] = m.Owner
+	default:
 		mm["owner_id"] = m.Owner.ID
 	}
-	if !m.TimeMetadata.CreatedAt.IsZero() {
-		mm["created_at"] = m.TimeMetadata.CreatedAt
+	if m.CreatedBy != nil {
+		mm["created_by"] = m.CreatedBy.ID
 	}
-	if !m.TimeMetadata.UpdatedAt.IsZero() {
-		mm["updated_at"] = m.TimeMetadata.UpdatedAt
+	return mm
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// It is the counterpart of MarshalJSON: `owner_id` is decoded into a stub Owner
+// and an inline `owner` object, see MarshalOwnerInline, into the full Owner.
+// The owner id is only ever read from `owner_id`, the key MarshalJSON emits, and not from `user_id`
+// which is the Owner own JSON key: a stray `user_id` at the metadata level is ignored.
+// When both `owner` and `owner_id` are present, `owner_id` wins and a mismatching `owner` is dropped.
+func (m *Metadata) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
 	}
-	if m.TimeMetadata.DeletedAt != nil && !m.TimeMetadata.DeletedAt.IsZero() {
-		mm["deleted_at"] = m.TimeMetadata.DeletedAt
+	var mm struct {
+		Owner     *User   `json:"owner"`
+		OwnerID   *string `json:"owner_id"`
+		CreatedBy *string `json:"created_by"`
 	}
-	return json.Marshal(mm)
+	if err := json.Unmarshal(b, &mm); err != nil {
+		return errors.Wrap(err, "error decoding Metadata")
+	}
+	m.Owner = mm.Owner
+	if mm.OwnerID != nil {
+		ownerID := uuid.UUID{}
+		if err := ownerID.UnmarshalText([]byte(*mm.OwnerID)); err != nil {
+			return errors.Wrap(err, "invalid owner_id for Metadata")
+		}
+		if m.Owner == nil || !uuid.Equal(m.Owner.ID, ownerID) {
+			m.Owner = &User{ID: ownerID}
+		}
+	}
+	m.CreatedBy = nil
+	if mm.CreatedBy != nil {
+		createdBy := uuid.UUID{}
+		if err := createdBy.UnmarshalText([]byte(*mm.CreatedBy)); err != nil {
+			return errors.Wrap(err, "invalid created_by for Metadata")
+		}
+		m.CreatedBy = &User{ID: createdBy}
+	}
+	return errors.Wrap(m.TimeMetadata.UnmarshalJSON(b), "error decoding Metadata timestamps")
 }
 
 // Scan1 implements sql.Scan interface.
+// It reads a `(owner_id,created_at,updated_at,deleted_at[,created_by])` composite or, from a jsonb column,
+// a JSON object as decoded by UnmarshalJSON or, from an hstore column, the same keys, see scanHStore.
 func (m *Metadata) Scan1(src interface{}) error {
-	s, err := ScanToString(src)
+	b, err := scanToBytes(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for Metadata scan")
+	}
+	if isJSONObject(b) {
+		if err := m.UnmarshalJSON(b); err != nil {
+			return errors.Wrap(err, "error parsing Metadata jsonb")
+		}
+		return nil
+	}
+	if isHStore(b) {
+		return m.scanHStore(b)
+	}
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing Metadata composite")
+	}
+	return m.scanFields(parts)
+}
+
+// ScanLoose is Scan1 for the legacy views exposing a partial metadata composite, mapping its fields by count:
+// `(owner_id,created_at,updated_at,deleted_at)`, `(created_at,updated_at,deleted_at)`
+// or `(created_at,updated_at)`. The missing fields, including CreatedBy, are reset to nil.
+// The jsonb and hstore sources, whose keys are already optional, are decoded like Scan1 does.
+func (m *Metadata) ScanLoose(src interface{}) error {
+	b, err := scanToBytes(src)
 	if err != nil {
 		return errors.Wrap(err, "invalid type for Metadata scan")
 	}
-	s = strings.Trim(s, "()")
-	parts := strings.Split(s, ",")
-	if len(parts) != 4 {
-		return errors.New("invalid count for Metadata scan")
+	if isJSONObject(b) || isHStore(b) {
+		return m.Scan1(b)
 	}
-	for i, part := range parts {
-		parts[i] = strings.Trim(part, `"`)
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing Metadata composite")
 	}
-	ownerID := uuid.Parse(parts[0])
-	if ownerID == nil {
-		return errors.New("invalid owner_id for Metadata scan")
+	switch len(parts) {
+	case 4:
+		return m.scanFields(parts)
+	case 3:
+		m.Owner, m.CreatedBy = nil, nil
+		return m.TimeMetadata.scanFields(parts)
+	case 2:
+		m.Owner, m.CreatedBy = nil, nil
+		return m.TimeMetadata.scanFields(append(parts, sql.NullString{}))
+	default:
+		return errors.Wrapf(ErrInvalidCount, "Metadata loose scan: expected 2 to 4 fields, got %d", len(parts))
 	}
-	m.Owner = &User{ID: ownerID}
+}
 
-	return m.TimeMetadata.Scan1("(" + strings.Join(parts[1:], ",") + ")")
+// scanHStore decodes an hstore, i.e. `"owner_id"=>NULL, "created_at"=>"2020-01-01 00:00:00+00", ...`,
+// with the same rules as the composite fields. Missing keys are NULL and unknown keys are ignored.
+func (m *Metadata) scanHStore(b []byte) error {
+	h := hstore.Hstore{}
+	if err := h.Scan(b); err != nil {
+		return errors.Wrap(err, "error parsing Metadata hstore")
+	}
+	fields := []sql.NullString{
+		h.Map["owner_id"],
+		h.Map["created_at"],
+		h.Map["updated_at"],
+		h.Map["deleted_at"],
+	}
+	if createdBy, ok := h.Map["created_by"]; ok {
+		fields = append(fields, createdBy)
+	}
+	return m.scanFields(fields)
+}
+
+// scanFields decodes the already tokenized `owner_id,created_at,updated_at,deleted_at` fields,
+// i.e. the trailing fields of a flat row composite, optionally followed by `created_by`.
+func (m *Metadata) scanFields(parts []sql.NullString) error {
+	if len(parts) != 4 && len(parts) != 5 {
+		return countError("Metadata", 4, len(parts), joinComposite(parts))
+	}
+	// A NULL or `uuid_nil()` owner means no owner.
+	m.Owner = nil
+	if parts[0].Valid {
+		ownerID := uuid.Parse(parts[0].String)
+		if ownerID == nil {
+			return errors.New("invalid owner_id for Metadata scan")
+		}
+		if !IsNil(ownerID) {
+			m.Owner = &User{ID: ownerID}
+		}
+	}
+	// The optional trailing created_by, NULL when unknown.
+	m.CreatedBy = nil
+	if len(parts) == 5 && parts[4].Valid {
+		createdBy := uuid.Parse(parts[4].String)
+		if createdBy == nil {
+			return errors.New("invalid created_by for Metadata scan")
+		}
+		m.CreatedBy = &User{ID: createdBy}
+	}
+
+	return m.TimeMetadata.scanFields(parts[1:4])
+}
+
+// Value implements driver.Valuer interface.
+// It emits the `(owner_id,created_at,updated_at,deleted_at)` composite expected by Scan1,
+// followed by created_by only when CreatedBy is set, so the composite is unchanged without a creator.
+func (m Metadata) Value() (driver.Value, error) {
+	fields, err := m.compositeFields()
+	if err != nil {
+		return nil, err
+	}
+	return "(" + strings.Join(fields, ",") + ")", nil
+}
+
+// compositeFields returns the encoded owner_id and timestamp fields of the composite.
+// A nil Owner is left empty.
+func (m Metadata) compositeFields() ([]string, error) {
+	ownerID := ""
+	if m.Owner != nil {
+		if m.Owner.ID == nil {
+			return nil, errors.New("invalid owner_id for Metadata value")
+		}
+		ownerID = encodeCompositeField(m.Owner.ID.String())
+	}
+	fields := append([]string{ownerID}, m.TimeMetadata.compositeFields()...)
+	if m.CreatedBy != nil {
+		if m.CreatedBy.ID == nil {
+			return nil, errors.New("invalid created_by for Metadata value")
+		}
+		fields = append(fields, encodeCompositeField(m.CreatedBy.ID.String()))
+	}
+	return fields, nil
 }
 
 // User .
+// The memberships are omitted from the JSON when empty: `omitempty` checks the slice length,
+// so a non-nil empty slice, i.e. from a scan, is omitted like a nil one and no custom MarshalJSON is needed.
 type User struct {
 	ID uuid.UUID `json:"user_id" db:"user_id"`
 
@@ -153,15 +472,91 @@ type User struct {
 	Metadata Metadata `json:"metadata" db:"metadata"`
 }
 
+// NewUser instantiates a new User with a random id and fresh timestamps.
+func NewUser() *User {
+	u := &User{ID: newUUID()}
+	u.Metadata.Touch()
+	return u
+}
+
+// OwnerID returns the id of the user owner.
+// ok is false when the user has no owner.
+func (u *User) OwnerID() (id uuid.UUID, ok bool) {
+	if u.Metadata.Owner == nil || u.Metadata.Owner.ID == nil {
+		return nil, false
+	}
+	return u.Metadata.Owner.ID, true
+}
+
+// Scan implements sql.Scanner interface.
+// It expects a whole users row composite, i.e. `SELECT u FROM users u`:
+// `(user_id,owner_id,created_at,updated_at,deleted_at)`. The memberships are not part of the composite.
+// A NULL row, i.e. from a LEFT JOIN, leaves the user untouched.
+func (u *User) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	b, err := scanToBytes(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for User scan")
+	}
+
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing User composite")
+	}
+	if len(parts) != 5 {
+		return countError("User", 5, len(parts), string(b))
+	}
+
+	u.ID = uuid.Parse(parts[0].String)
+	if u.ID == nil {
+		return errors.New("invalid user_id")
+	}
+	if err := u.Metadata.scanFields(parts[1:]); err != nil {
+		return errors.Wrap(err, "error scan Metadata for User")
+	}
+	if StrictScan {
+		if err := u.Validate(); err != nil {
+			return errors.Wrap(err, "invalid User")
+		}
+	}
+	return nil
+}
+
+// UserRow is the flat users row, for the queries selecting plain columns rather than composites,
+// i.e. `SELECT user_id, owner_id, created_at, updated_at, deleted_at FROM users` scanned with sqlx.
+type UserRow struct {
+	UserID    uuid.UUID  `db:"user_id"`
+	OwnerID   *uuid.UUID `db:"owner_id"` // Nil when NULL: database/sql cannot scan NULL into a uuid.UUID.
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	DeletedAt NullTime   `db:"deleted_at"`
+}
+
+// ToUser returns the User of the row, without memberships.
+// A NULL or `uuid_nil()` owner_id means no owner.
+func (r UserRow) ToUser() *User {
+	u := &User{ID: r.UserID}
+	if r.OwnerID != nil && !IsNil(*r.OwnerID) {
+		u.Metadata.Owner = &User{ID: *r.OwnerID}
+	}
+	u.Metadata.CreatedAt = Timestamp(r.CreatedAt)
+	u.Metadata.UpdatedAt = Timestamp(r.UpdatedAt)
+	u.Metadata.DeletedAt = r.DeletedAt.TimestampPtr()
+	return u
+}
+
 // UserOrganizations .
 type UserOrganizations []UserOrganization
 
 // Scan implement sql.Scanner interface.
+// NULL elements, as produced by `array_agg` over an empty LEFT JOIN, are skipped.
+// A bare `(..)` composite is scanned as a single membership.
 func (uos *UserOrganizations) Scan(src interface{}) error {
-	var strArray pq.StringArray
-
-	if err := strArray.Scan(src); err != nil {
-		return errors.Wrap(err, "error parsing db result into string array")
+	strArray, err := parseArray(src)
+	if err != nil {
+		return err
 	}
 
 	for _, elem := range strArray {
@@ -174,28 +569,58 @@ func (uos *UserOrganizations) Scan(src interface{}) error {
 	return nil
 }
 
+// Value implements driver.Valuer interface.
+// It emits an array of UserOrganization composites in the slice order, the counterpart of Scan.
+// An empty or nil slice is the empty array `{}`, not NULL.
+func (uos UserOrganizations) Value() (driver.Value, error) {
+	elems := make([]driver.Valuer, len(uos))
+	for i, uo := range uos {
+		elems[i] = uo
+	}
+	return marshalCompositeArray(elems)
+}
+
 // UserOrganization .
 type UserOrganization struct {
 	UserID         uuid.UUID `json:"user_id"         db:"user_id"`
 	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
 
-	Role string `json:"role" db:"role"`
+	Role Role `json:"role" db:"role"`
 
 	Metadata Metadata `json:"metadata" db:"metadata"`
 }
 
 // Scan impements sql.Scanner interface.
+// It expects a `(user_id,organization_id,role,metadata)` composite where metadata
+// is the nested `(owner_id,created_at,updated_at,deleted_at)` composite.
+// The flat user_organization_join row form, i.e. `array_agg(uoj)`, is accepted as well:
+// it follows the table column order, `(organization_id,user_id,user_role,owner_id,created_at,updated_at,deleted_at)`.
 func (uo *UserOrganization) Scan(src interface{}) error {
-	s, err := ScanToString(src)
+	b, err := scanToBytes(src)
 	if err != nil {
 		return errors.Wrap(err, "invalid type for UserOrganization scan")
 	}
 
-	parts := strings.Split(strings.Trim(s, "()"), ",")
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing UserOrganization composite")
+	}
+	return uo.scanFields(parts)
+}
+
+// scanFields decodes the already tokenized membership fields, in either form accepted by Scan.
+func (uo *UserOrganization) scanFields(parts []sql.NullString) error {
+	if len(parts) != 4 && len(parts) != 7 {
+		return countError("UserOrganization", 4, len(parts), joinComposite(parts))
+	}
 
-	uo.UserID = uuid.Parse(parts[0])
-	uo.OrganizationID = uuid.Parse(parts[1])
-	uo.Role = parts[2]
+	// The table row starts with organization_id, unlike the membership composite.
+	userIdx, organizationIdx := 0, 1
+	if len(parts) == 7 {
+		userIdx, organizationIdx = 1, 0
+	}
+	uo.UserID = uuid.Parse(parts[userIdx].String)
+	uo.OrganizationID = uuid.Parse(parts[organizationIdx].String)
 
 	if uo.UserID == nil {
 		return errors.New("invalid user_id")
@@ -203,36 +628,195 @@ func (uo *UserOrganization) Scan(src interface{}) error {
 	if uo.OrganizationID == nil {
 		return errors.New("invalid organization_id")
 	}
-	if uo.Role == "" {
-		return errors.New("invalid user_role")
+	var err error
+	if uo.Role, err = ParseRole(parts[2].String); err != nil {
+		return errors.Wrap(err, "invalid role")
 	}
-	tm := "(" + strings.Join(parts[3:7], ",") + ")"
-	if err := uo.Metadata.Scan1(tm); err != nil {
-		return errors.Wrap(err, "error scan TimeMetadata for UserOrganization")
+	if len(parts) == 4 {
+		err = uo.Metadata.Scan1(parts[3].String)
+	} else {
+		err = uo.Metadata.scanFields(parts[3:])
+	}
+	if err != nil {
+		return errors.Wrap(err, "error scan Metadata for UserOrganization")
+	}
+	if StrictScan {
+		if err := uo.Validate(); err != nil {
+			return errors.Wrap(err, "invalid UserOrganization")
+		}
+		if err := uo.checkOwnerParty(); err != nil {
+			return errors.Wrap(err, "invalid UserOrganization")
+		}
 	}
 
 	return nil
 }
 
+// checkOwnerParty returns an error when the membership owner is neither the member nor the organization.
+// A membership without owner passes.
+func (uo *UserOrganization) checkOwnerParty() error {
+	owner := uo.Metadata.Owner
+	if owner == nil || uuid.Equal(owner.ID, uo.UserID) || uuid.Equal(owner.ID, uo.OrganizationID) {
+		return nil
+	}
+	return errors.Errorf("owner %s is neither the user nor the organization", owner.ID)
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// Nil or zero ids are omitted, as is the metadata when it has neither owner nor timestamps,
+// which keeps the membership arrays compact.
+func (uo UserOrganization) MarshalJSON() ([]byte, error) {
+	mm := map[string]interface{}{
+		"role": uo.Role,
+	}
+	if !IsNil(uo.UserID) {
+		mm["user_id"] = uo.UserID
+	}
+	if !IsNil(uo.OrganizationID) {
+		mm["organization_id"] = uo.OrganizationID
+	}
+	if metadata := uo.Metadata.jsonFields(); len(metadata) != 0 {
+		mm["metadata"] = metadata
+	}
+	return json.Marshal(mm)
+}
+
+// Value implements driver.Valuer interface.
+// It emits the `(user_id,organization_id,role,metadata)` composite expected by Scan.
+func (uo UserOrganization) Value() (driver.Value, error) {
+	fields, err := uo.compositeFields()
+	if err != nil {
+		return nil, err
+	}
+	return "(" + strings.Join(fields, ",") + ")", nil
+}
+
+// compositeFields returns the encoded `user_id,organization_id,role,metadata` fields of the composite.
+func (uo UserOrganization) compositeFields() ([]string, error) {
+	if uo.UserID == nil {
+		return nil, errors.New("invalid user_id for UserOrganization value")
+	}
+	if uo.OrganizationID == nil {
+		return nil, errors.New("invalid organization_id for UserOrganization value")
+	}
+	metadata, err := uo.Metadata.Value()
+	if err != nil {
+		return nil, errors.Wrap(err, "error value Metadata for UserOrganization")
+	}
+	return []string{
+		uo.UserID.String(),
+		uo.OrganizationID.String(),
+		encodeCompositeField(string(uo.Role)),
+		encodeCompositeField(metadata.(string)),
+	}, nil
+}
+
 // Organization .
 type Organization struct {
 	ID uuid.UUID `json:"organization_id" db:"organization_id"`
 
-	Users       []*UserOrganization `json:"users"                  db:"users"`
-	Teams       []*Team             `json:"teams,omitempty"        db:"teams"`
-	PaymentPlan *PaymentPlan        `json:"payment_plan,omitempty" db:"payment_plan"`
+	Users       OrganizationUsers `json:"users"                  db:"users"`
+	Teams       Teams             `json:"teams,omitempty"        db:"teams"`
+	PaymentPlan *PaymentPlan      `json:"payment_plan,omitempty" db:"payment_plan"`
 
 	Metadata Metadata `json:"metadata" db:"metadata"`
 }
 
+// NewOrganization instantiates a new Organization with a random id and fresh timestamps.
+func NewOrganization() *Organization {
+	o := &Organization{ID: newUUID()}
+	o.Metadata.Touch()
+	return o
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// It always emits `organization_id`, `users` and `metadata`, while `teams` and `payment_plan` are optional.
+// The teams organization is omitted as it is the enclosing one.
+func (o Organization) MarshalJSON() ([]byte, error) {
+	users := o.Users
+	if users == nil {
+		users = OrganizationUsers{}
+	}
+	var teams Teams
+	for _, t := range o.Teams {
+		if t != nil {
+			tc := *t
+			tc.Organization = nil
+			t = &tc
+		}
+		teams = append(teams, t)
+	}
+	return json.Marshal(struct {
+		ID          uuid.UUID         `json:"organization_id"`
+		Users       OrganizationUsers `json:"users"`
+		Teams       Teams             `json:"teams,omitempty"`
+		PaymentPlan *PaymentPlan      `json:"payment_plan,omitempty"`
+		Metadata    Metadata          `json:"metadata"`
+	}{
+		ID:          o.ID,
+		Users:       users,
+		Teams:       teams,
+		PaymentPlan: o.PaymentPlan,
+		Metadata:    o.Metadata,
+	})
+}
+
+// OrganizationUsers .
+type OrganizationUsers []*UserOrganization
+
+// Scan implement sql.Scanner interface.
+// It expects an array of UserOrganization composites:
+//
+//	SELECT
+//	  o.organization_id,
+//	  array_agg((uoj.user_id, uoj.organization_id, uoj.user_role,
+//	             (uoj.owner_id, uoj.created_at, uoj.updated_at, uoj.deleted_at)))
+//	    FILTER (WHERE uoj.user_id IS NOT NULL) AS "users"
+//	FROM organizations o
+//	LEFT JOIN user_organization_join uoj
+//	  USING (organization_id)
+//	GROUP BY o.organization_id
+//
+// The FILTER drops the unmatched LEFT JOIN row, whose all-NULL fields would still build a non-NULL composite.
+// A NULL array and NULL elements are skipped.
+func (ous *OrganizationUsers) Scan(src interface{}) error {
+	strArray, err := parseArray(src)
+	if err != nil {
+		return err
+	}
+
+	for _, elem := range strArray {
+		uo := &UserOrganization{}
+		if err := uo.Scan(elem); err != nil {
+			return errors.Wrap(err, "error parsing db result element into organization user")
+		}
+		*ous = append(*ous, uo)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer interface.
+// It emits an array of UserOrganization composites, the counterpart of Scan.
+func (ous OrganizationUsers) Value() (driver.Value, error) {
+	elems := make([]driver.Valuer, len(ous))
+	for i, uo := range ous {
+		if uo != nil {
+			elems[i] = uo
+		}
+	}
+	return marshalCompositeArray(elems)
+}
+
 // UserTeam .
+// TeamID identifies the team among the ones of the organization, nil when the membership was not loaded along with it.
 type UserTeam struct {
-	UserID         uuid.UUID `json:"user_id"         db:"user_id"`
-	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	UserID         uuid.UUID `json:"user_id"           db:"user_id"`
+	OrganizationID uuid.UUID `json:"organization_id"   db:"organization_id"`
+	TeamID         uuid.UUID `json:"team_id,omitempty" db:"team_id"`
 
-	Role string `json:"role" db:"role"`
+	Role Role `json:"role" db:"role"`
 
-	Metadata Metadata `json:"metadata"`
+	Metadata Metadata `json:"metadata" db:"metadata"`
 }
 
 // Team .
@@ -240,10 +824,11 @@ type Team struct {
 	ID uuid.UUID `json:"team_id" db:"team_id"`
 
 	Organization *Organization `json:"organization,omitempty" db:"organization"`
-	Users        []*UserTeam   `json:"users"                  db:"users"`
+	Users        TeamUsers     `json:"users"                  db:"users"`
 
-	Name     string `json:"name"     db:"name"`
-	Capacity int    `json:"capacity" db:"capacity"` // Maximum number of users in the team. 0 = no limit.
+	Name         string `json:"name"     db:"name"`
+	Capacity     int    `json:"capacity" db:"capacity"` // Maximum number of users in the team. 0 = no limit.
+	CapacityNull bool   `json:"-"        db:"-"`        // The capacity is NULL in the database, no limit either.
 
 	Metadata Metadata `json:"metadata"`
 }
@@ -255,35 +840,60 @@ type PaymentPlan struct {
 	Name     string  `json:"name"     db:"name"`
 	Cost     float64 `json:"cost"     db:"cost"`
 	Currency string  `json:"currency" db:"currency"`
-	Term     string  `json:"term"     db:"term"` // Term of the payment plan. "Yearly", "Monthly", etc..
+	Term     Term    `json:"term"     db:"term"` // Term of the payment plan. "Yearly", "Monthly", etc..
 
-	Metadata `json:",inline" db:"metadata"`
+	Metadata `json:",inline" db:"metadata"` // Inlined by MarshalJSON and UnmarshalJSON, not by the tag.
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// The metadata fields are inlined next to the plan fields.
+// encoding/json has no `inline` option: without this method, the MarshalJSON promoted
+// from the embedded Metadata would encode the metadata alone, dropping the plan fields.
+func (pp PaymentPlan) MarshalJSON() ([]byte, error) {
+	mm := pp.Metadata.jsonFields()
+	mm["payment_plan_id"] = pp.ID
+	mm["name"] = pp.Name
+	mm["cost"] = pp.Cost
+	mm["currency"] = pp.Currency
+	mm["term"] = pp.Term
+	return json.Marshal(mm)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// It is the counterpart of MarshalJSON and reads the inlined metadata fields.
+func (pp *PaymentPlan) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var mm struct {
+		ID       uuid.UUID `json:"payment_plan_id"`
+		Name     string    `json:"name"`
+		Cost     float64   `json:"cost"`
+		Currency string    `json:"currency"`
+		Term     Term      `json:"term"`
+	}
+	if err := json.Unmarshal(b, &mm); err != nil {
+		return errors.Wrap(err, "error decoding PaymentPlan")
+	}
+	pp.ID = mm.ID
+	pp.Name = mm.Name
+	pp.Cost = mm.Cost
+	pp.Currency = mm.Currency
+	pp.Term = mm.Term
+	return errors.Wrap(pp.Metadata.UnmarshalJSON(b), "error decoding PaymentPlan metadata")
 }
 
 func test(ctx context.Context) error {
-	db, err := sqlx.ConnectContext(ctx, "postgres", "postgres://postgres@192.168.99.100:5432/test?sslmode=disable")
+	db, err := NewDB(ctx, "")
 	if err != nil {
-		return errors.Wrap(err, "error connect to db")
+		return err
 	}
 
-	const queryGetUser = `
-SELECT
-  u.user_id,
-  u.owner_id     AS "metadata.owner.user_id",
-  array_agg(uoj) AS "organization_memberships",
-  u.created_at   AS "metadata.timemetadata.created_at",
-  u.updated_at   AS "metadata.timemetadata.updated_at",
-  u.deleted_at   AS "metadata.timemetadata.deleted_at"
-FROM users u
-LEFT JOIN user_organization_join uoj
-  USING (user_id)
-WHERE u.user_id = uuid_nil()
-GROUP BY u.user_id
-`
+	users := NewUserRepository(db)
 
-	u := User{}
-	if err := db.GetContext(ctx, &u, queryGetUser); err != nil {
-		return errors.Wrap(err, "error get user")
+	u, err := users.GetByID(ctx, MustParseUUID("00000000-0000-0000-0000-000000000000"))
+	if err != nil {
+		return err
 	}
 
 	enc := json.NewEncoder(os.Stdout)
@@ -291,25 +901,8 @@ GROUP BY u.user_id
 	enc.SetIndent("", "    ")
 	_ = enc.Encode(u)
 
-	const queryInsertUser = `
-INSERT INTO users (
-  user_id,
-  owner_id
-) VALUES (
-  ?,
-  ?
-)
-`
-	u.ID = uuid.NewRandom()
-	query := db.Rebind(queryInsertUser)
-	if _, err := db.ExecContext(ctx, query,
-		u.ID,
-		u.Metadata.Owner.ID,
-	); err != nil {
-		return errors.Wrap(err, "error insert user")
-	}
-
-	return nil
+	u.ID = newUUID()
+	return users.Insert(ctx, u)
 }
 
 func main() {
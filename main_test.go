@@ -0,0 +1,833 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/uuid"
+)
+
+func TestTimeMetadataValueRoundTrip(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 123456000, time.UTC))
+	for _, tm := range []TimeMetadata{
+		{},
+		{CreatedAt: ts, UpdatedAt: ts},
+		{CreatedAt: ts, UpdatedAt: ts, DeletedAt: &ts},
+	} {
+		v, err := tm.Value()
+		if err != nil {
+			t.Fatalf("Error encoding %v: %s", tm, err)
+		}
+		parts, err := parseComposite(v.(string))
+		if err != nil || len(parts) != 3 {
+			t.Fatalf("Expected a well-formed 3 fields composite, got %q: %v", v, err)
+		}
+		if parts[2].Valid != (tm.DeletedAt != nil) {
+			t.Fatalf("Expected a NULL deleted_at only without DeletedAt, got %q", v)
+		}
+
+		var scanned TimeMetadata
+		if err := scanned.Scan1(v); err != nil {
+			t.Fatalf("Error scanning %q: %s", v, err)
+		}
+		if !scanned.Equal(tm) {
+			t.Fatalf("Expected %v, got %v", tm, scanned)
+		}
+	}
+}
+
+func TestMetadataValueRoundTrip(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	tm := TimeMetadata{CreatedAt: ts, UpdatedAt: ts}
+	for _, m := range []Metadata{
+		{TimeMetadata: tm},
+		{Owner: &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")}, TimeMetadata: tm},
+	} {
+		v, err := m.Value()
+		if err != nil {
+			t.Fatalf("Error encoding %v: %s", m, err)
+		}
+		var scanned Metadata
+		if err := scanned.Scan1(v); err != nil {
+			t.Fatalf("Error scanning %q: %s", v, err)
+		}
+		if !scanned.Equal(m) {
+			t.Fatalf("Expected %v, got %v", m, scanned)
+		}
+	}
+
+	if _, err := (Metadata{Owner: &User{}}).Value(); err == nil {
+		t.Fatal("Expected an error for an owner without id")
+	}
+}
+
+func TestUserOrganizationsScanNullElements(t *testing.T) {
+	membership := `"(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,member,\"(,2020-01-02,2020-01-02,)\")"`
+	for src, expect := range map[string]int{
+		`{NULL}`:                    0,
+		`{NULL,NULL}`:               0,
+		`{` + membership + `,NULL}`: 1,
+		`{NULL,` + membership + `}`: 1,
+		`{` + membership + `}`:      1,
+	} {
+		var uos UserOrganizations
+		if err := uos.Scan([]byte(src)); err != nil {
+			t.Fatalf("Error scanning %s: %s", src, err)
+		}
+		if len(uos) != expect {
+			t.Fatalf("%s: expected %d memberships, got %v", src, expect, uos)
+		}
+	}
+}
+
+func TestTimeMetadataUnmarshalJSON(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 123456000, time.UTC))
+	for _, tm := range []TimeMetadata{
+		{},
+		{CreatedAt: ts},
+		{CreatedAt: ts, UpdatedAt: ts, DeletedAt: &ts},
+	} {
+		buf, err := json.Marshal(tm)
+		if err != nil {
+			t.Fatalf("Error marshaling %v: %s", tm, err)
+		}
+		var decoded TimeMetadata
+		if err := json.Unmarshal(buf, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling %s: %s", buf, err)
+		}
+		if !decoded.Equal(tm) {
+			t.Fatalf("%s: expected %v, got %v", buf, tm, decoded)
+		}
+	}
+
+	tm := TimeMetadata{CreatedAt: ts}
+	if err := tm.UnmarshalJSON([]byte("null")); err != nil || !tm.CreatedAt.Equal(ts) {
+		t.Fatalf("Expected a null body to leave the timestamps untouched, got %v, %v", tm, err)
+	}
+	if err := json.Unmarshal([]byte(`{"created_at":"nope"}`), &tm); err == nil {
+		t.Fatal("Expected an error for an invalid timestamp")
+	}
+}
+
+func TestMetadataUnmarshalJSON(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	for _, m := range []Metadata{
+		{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}},
+		{Owner: &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")}, TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts, DeletedAt: &ts}},
+	} {
+		buf, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Error marshaling %v: %s", m, err)
+		}
+		var decoded Metadata
+		if err := json.Unmarshal(buf, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling %s: %s", buf, err)
+		}
+		if !decoded.Equal(m) {
+			t.Fatalf("%s: expected %v, got %v", buf, m, decoded)
+		}
+	}
+
+	var m Metadata
+	if err := json.Unmarshal([]byte(`{"owner_id":"nope"}`), &m); err == nil {
+		t.Fatal("Expected an error for an invalid owner_id")
+	}
+}
+
+func TestUserJSONRoundTrip(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	owner := &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")}
+	userID := MustParseUUID("00000000-0000-0000-0000-000000000002")
+	orgID := MustParseUUID("00000000-0000-0000-0000-000000000003")
+	metadata := Metadata{Owner: owner, TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}}
+
+	for _, tc := range []struct {
+		name string
+		user User
+	}{
+		{name: "bare", user: User{ID: userID}},
+		{name: "metadata", user: User{ID: userID, Metadata: metadata}},
+		{name: "memberships", user: User{
+			ID:            userID,
+			Organizations: UserOrganizations{{UserID: userID, OrganizationID: orgID, Role: RoleAdmin, Metadata: metadata}},
+			Teams: []UserTeam{{
+				UserID:         userID,
+				OrganizationID: orgID,
+				TeamID:         MustParseUUID("00000000-0000-0000-0000-000000000004"),
+				Role:           RoleMember,
+				Metadata:       metadata,
+			}},
+			Metadata: metadata,
+		}},
+		{name: "payment plan", user: User{
+			ID: userID,
+			PaymentPlan: &PaymentPlan{
+				ID:       MustParseUUID("00000000-0000-0000-0000-000000000005"),
+				Name:     "pro",
+				Cost:     19.99,
+				Currency: "USD",
+				Term:     TermMonthly,
+				Metadata: metadata,
+			},
+			Metadata: metadata,
+		}},
+	} {
+		buf, err := json.Marshal(&tc.user)
+		if err != nil {
+			t.Fatalf("%s: error marshaling: %s", tc.name, err)
+		}
+		decoded := &User{}
+		if err := json.Unmarshal(buf, decoded); err != nil {
+			t.Fatalf("%s: error unmarshaling %s: %s", tc.name, buf, err)
+		}
+		if !decoded.Equal(&tc.user) {
+			t.Fatalf("%s: round trip mismatch for %s:\nexpected %v\ngot      %v", tc.name, buf, tc.user, decoded)
+		}
+	}
+}
+
+func TestOrganizationUsersScan(t *testing.T) {
+	orgID := MustParseUUID("00000000-0000-0000-0000-00000000000b")
+	members := OrganizationUsers{
+		{UserID: MustParseUUID("00000000-0000-0000-0000-000000000001"), OrganizationID: orgID, Role: RoleOwner},
+		nil,
+		{UserID: MustParseUUID("00000000-0000-0000-0000-000000000002"), OrganizationID: orgID, Role: RoleMember},
+	}
+	v, err := members.Value()
+	if err != nil {
+		t.Fatalf("Error encoding members: %s", err)
+	}
+
+	var scanned OrganizationUsers
+	if err := scanned.Scan([]byte(v.(string))); err != nil {
+		t.Fatalf("Error scanning %s: %s", v, err)
+	}
+	if len(scanned) != 2 {
+		t.Fatalf("Expected 2 members, the NULL one skipped, got %v", scanned)
+	}
+	if !scanned[0].Equal(members[0]) || !scanned[1].Equal(members[2]) {
+		t.Fatalf("Unexpected members %v", scanned)
+	}
+}
+
+func TestTimeMetadataDeleteRestore(t *testing.T) {
+	var m Metadata
+	if m.IsDeleted() {
+		t.Fatal("Expected a fresh metadata not to be deleted")
+	}
+
+	m.TimeMetadata.Delete()
+	if !m.IsDeleted() || m.DeletedAt.Time().Location() != time.UTC {
+		t.Fatalf("Expected a UTC deleted_at, got %v", m.DeletedAt)
+	}
+	deletedAt := *m.DeletedAt
+	m.TimeMetadata.Delete()
+	if !m.DeletedAt.Equal(deletedAt) {
+		t.Fatalf("Expected a second delete to keep %s, got %s", deletedAt, m.DeletedAt)
+	}
+
+	m.TimeMetadata.Restore()
+	m.TimeMetadata.Restore()
+	if m.IsDeleted() || m.DeletedAt != nil {
+		t.Fatalf("Expected a restored metadata, got %v", m.DeletedAt)
+	}
+}
+
+func TestMetadataTouch(t *testing.T) {
+	var m Metadata
+	m.Touch()
+	if m.CreatedAt.IsZero() || !m.UpdatedAt.Equal(m.CreatedAt) {
+		t.Fatalf("Expected the first touch to set both timestamps, got %v", m.TimeMetadata)
+	}
+	if m.CreatedAt.Time().Location() != time.UTC || m.UpdatedAt.Time().Location() != time.UTC {
+		t.Fatalf("Expected UTC timestamps, got %v", m.TimeMetadata)
+	}
+
+	createdAt := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	m.CreatedAt = createdAt
+	m.Touch()
+	if !m.CreatedAt.Equal(createdAt) || !m.UpdatedAt.After(createdAt) {
+		t.Fatalf("Expected a later touch to only bump updated_at, got %v", m.TimeMetadata)
+	}
+}
+
+func TestScanToString(t *testing.T) {
+	for _, src := range []interface{}{
+		"(a,b)",
+		[]byte("(a,b)"),
+		sql.RawBytes("(a,b)"),
+		stringer("(a,b)"),
+	} {
+		s, err := ScanToString(src)
+		if err != nil || s != "(a,b)" {
+			t.Fatalf("%T: expected (a,b), got %q, %v", src, s, err)
+		}
+	}
+	for _, src := range []interface{}{nil, 42, 4.2, true} {
+		if _, err := ScanToString(src); !errors.Is(err, ErrInvalidType) {
+			t.Fatalf("%T: expected ErrInvalidType, got %v", src, err)
+		}
+	}
+}
+
+// stringer is a fmt.Stringer source.
+type stringer string
+
+func (s stringer) String() string { return string(s) }
+
+func TestMetadataSetOwner(t *testing.T) {
+	var m Metadata
+	for _, id := range []uuid.UUID{nil, NilUUID} {
+		if err := m.SetOwner(id); err == nil {
+			t.Fatalf("Expected an error setting the %q owner", id)
+		}
+		if m.Owner != nil {
+			t.Fatalf("Expected no owner after a rejected SetOwner, got %v", m.Owner)
+		}
+	}
+
+	id := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	if err := m.SetOwner(id); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if m.Owner == nil || !uuid.Equal(m.Owner.ID, id) {
+		t.Fatalf("Expected owner %s, got %v", id, m.Owner)
+	}
+	m.ClearOwner()
+	if m.Owner != nil {
+		t.Fatalf("Expected ClearOwner to nil the owner, got %v", m.Owner)
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	for name, m := range map[string]Metadata{
+		"user":         NewUser().Metadata,
+		"organization": NewOrganization().Metadata,
+		"team":         NewTeam("core", 0).Metadata,
+		"payment plan": NewPaymentPlan("pro", 1, "USD", TermMonthly).Metadata,
+	} {
+		if m.CreatedAt.IsZero() || m.UpdatedAt.IsZero() {
+			t.Fatalf("%s: expected non-zero timestamps, got %v", name, m.TimeMetadata)
+		}
+	}
+	for name, id := range map[string]uuid.UUID{
+		"user":         NewUser().ID,
+		"organization": NewOrganization().ID,
+		"team":         NewTeam("core", 0).ID,
+		"payment plan": NewPaymentPlan("pro", 1, "USD", TermMonthly).ID,
+	} {
+		if IsNil(id) || uuid.Parse(id.String()) == nil {
+			t.Fatalf("%s: expected a valid uuid, got %q", name, id)
+		}
+	}
+}
+
+func TestUserOrganizationScanTableRow(t *testing.T) {
+	// `SELECT uoj FROM user_organization_join uoj`, in the table column order.
+	const row = `(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,admin,,"2020-01-02 03:04:05.123456+00","2020-01-02 03:04:05.123456+00",)`
+
+	uo := UserOrganization{}
+	if err := uo.Scan([]byte(row)); err != nil {
+		t.Fatalf("Error scanning table row: %s", err)
+	}
+	if expect := "00000000-0000-0000-0000-00000000000a"; uo.OrganizationID.String() != expect {
+		t.Fatalf("Expected organization_id %s, got %s", expect, uo.OrganizationID)
+	}
+	if expect := "00000000-0000-0000-0000-00000000000b"; uo.UserID.String() != expect {
+		t.Fatalf("Expected user_id %s, got %s", expect, uo.UserID)
+	}
+	if uo.Role != RoleAdmin || uo.Metadata.Owner != nil || uo.Metadata.CreatedAt.Time().Nanosecond() != 123456000 {
+		t.Fatalf("Unexpected membership %v", uo)
+	}
+}
+
+func TestUserOrganizationScanTableRowFromDB(t *testing.T) {
+	db := openTestDB(t)
+
+	var row string
+	if err := db.Get(&row, `SELECT uoj::text FROM user_organization_join uoj LIMIT 1`); err != nil {
+		t.Fatalf("Error selecting the seeded membership row: %s", err)
+	}
+	uo := UserOrganization{}
+	if err := uo.Scan(row); err != nil {
+		t.Fatalf("Error scanning %s: %s", row, err)
+	}
+	if uo.Role != RoleMember {
+		t.Fatalf("Unexpected role %q", uo.Role)
+	}
+}
+
+func TestUserOrganizationScanNullOwner(t *testing.T) {
+	var uo UserOrganization
+	src := `(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,viewer,"(,""2020-01-02 03:04:05+00"",""2020-01-03 03:04:05+00"",""2020-01-04 03:04:05+00"")")`
+	if err := uo.Scan(src); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if uo.Role != RoleViewer || uo.Metadata.Owner != nil {
+		t.Fatalf("Unexpected membership %v", uo)
+	}
+	day := func(d int) Timestamp { return Timestamp(time.Date(2020, 1, d, 3, 4, 5, 0, time.UTC)) }
+	tm := uo.Metadata.TimeMetadata
+	if !tm.CreatedAt.Equal(day(2)) || !tm.UpdatedAt.Equal(day(3)) || tm.DeletedAt == nil || !tm.DeletedAt.Equal(day(4)) {
+		t.Fatalf("Unexpected timestamps %v", tm)
+	}
+}
+
+func TestUserOrganizationsScanBareComposite(t *testing.T) {
+	membership := `(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,member,"(,2020-01-02,2020-01-02,)")`
+	for _, src := range []string{
+		`{"` + strings.Replace(membership, `"`, `\"`, -1) + `"}`,
+		membership,
+		"  " + membership + "\n",
+	} {
+		var uos UserOrganizations
+		if err := uos.Scan([]byte(src)); err != nil {
+			t.Fatalf("Error scanning %s: %s", src, err)
+		}
+		if len(uos) != 1 || uos[0].Role != RoleMember {
+			t.Fatalf("%s: expected a single membership, got %v", src, uos)
+		}
+	}
+
+	var uos UserOrganizations
+	if err := uos.Scan([]byte("member")); err == nil {
+		t.Fatal("Expected an error for a payload which is neither an array nor a composite")
+	}
+}
+
+func TestUserOrganizationMarshalJSONGolden(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	for _, tc := range []struct {
+		uo     UserOrganization
+		expect string
+	}{
+		{
+			UserOrganization{Role: RoleMember},
+			`{"role":"member"}`,
+		},
+		{
+			UserOrganization{UserID: MustParseUUID("00000000-0000-0000-0000-000000000001"), OrganizationID: NilUUID, Role: RoleAdmin},
+			`{"role":"admin","user_id":"00000000-0000-0000-0000-000000000001"}`,
+		},
+		{
+			UserOrganization{
+				UserID:         MustParseUUID("00000000-0000-0000-0000-000000000001"),
+				OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000002"),
+				Role:           RoleMember,
+				Metadata:       Metadata{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}},
+			},
+			`{"metadata":{"created_at":"2020-01-02T03:04:05.000000Z","updated_at":"2020-01-02T03:04:05.000000Z"},` +
+				`"organization_id":"00000000-0000-0000-0000-000000000002","role":"member","user_id":"00000000-0000-0000-0000-000000000001"}`,
+		},
+	} {
+		buf, err := json.Marshal(tc.uo)
+		if err != nil {
+			t.Fatalf("Error marshaling %v: %s", tc.uo, err)
+		}
+		if string(buf) != tc.expect {
+			t.Fatalf("Unexpected JSON:\n%s\nexpected:\n%s", buf, tc.expect)
+		}
+	}
+}
+
+func TestUserScanComposite(t *testing.T) {
+	var u User
+	src := `(00000000-0000-0000-0000-000000000001,00000000-0000-0000-0000-000000000002,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00","2020-01-03 03:04:05+00")`
+	if err := u.Scan([]byte(src)); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if u.ID.String() != "00000000-0000-0000-0000-000000000001" {
+		t.Fatalf("Unexpected user_id %s", u.ID)
+	}
+	if u.Metadata.Owner == nil || u.Metadata.Owner.ID.String() != "00000000-0000-0000-0000-000000000002" || !u.Metadata.IsDeleted() {
+		t.Fatalf("Unexpected metadata %+v", u.Metadata)
+	}
+
+	null := User{ID: MustParseUUID("00000000-0000-0000-0000-000000000003")}
+	if err := null.Scan(nil); err != nil || null.ID.String() != "00000000-0000-0000-0000-000000000003" {
+		t.Fatalf("Expected a NULL row to leave the user untouched, got %v (%v)", null, err)
+	}
+
+	for _, src := range []string{
+		`(00000000-0000-0000-0000-000000000001,,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00")`,
+		`(,,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`,
+	} {
+		if err := new(User).Scan(src); err == nil {
+			t.Fatalf("Expected an error scanning %s", src)
+		}
+	}
+}
+
+func TestMetadataMarshalOwnerInline(t *testing.T) {
+	defer func(prev bool) { MarshalOwnerInline = prev }(MarshalOwnerInline)
+
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	owner := &User{
+		ID:       MustParseUUID("00000000-0000-0000-0000-000000000001"),
+		Metadata: Metadata{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}},
+	}
+	full := Metadata{Owner: owner, TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}}
+	stub := Metadata{Owner: &User{ID: owner.ID}, TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}}
+
+	for _, tc := range []struct {
+		inline bool
+		m      Metadata
+		key    string
+	}{
+		{inline: false, m: full, key: `"owner_id":"00000000-0000-0000-0000-000000000001"`},
+		{inline: true, m: full, key: `"owner":{"user_id":"00000000-0000-0000-0000-000000000001"`},
+		{inline: true, m: stub, key: `"owner_id":"00000000-0000-0000-0000-000000000001"`},
+	} {
+		MarshalOwnerInline = tc.inline
+		buf, err := json.Marshal(tc.m)
+		if err != nil {
+			t.Fatalf("Error marshaling metadata: %s", err)
+		}
+		if !strings.Contains(string(buf), tc.key) {
+			t.Fatalf("inline=%t: expected %s in %s", tc.inline, tc.key, buf)
+		}
+
+		var got Metadata
+		if err := json.Unmarshal(buf, &got); err != nil {
+			t.Fatalf("Error unmarshaling %s: %s", buf, err)
+		}
+		if got.Owner == nil || !uuid.Equal(got.Owner.ID, owner.ID) {
+			t.Fatalf("inline=%t: unexpected owner %v", tc.inline, got.Owner)
+		}
+	}
+}
+
+func TestMetadataScanFieldCount(t *testing.T) {
+	const ts = `"2020-01-02 03:04:05+00"`
+	for _, tc := range []struct {
+		src string
+		ok  bool
+	}{
+		{`(,` + ts + `,` + ts + `,)`, true},
+		{`(,` + ts + `,` + ts + `,,)`, true}, // NULL created_by.
+		{`(,` + ts + `,` + ts + `)`, false},
+		{`(,` + ts + `,` + ts + `,,,)`, false},
+		{`(` + ts + `)`, false},
+	} {
+		var m Metadata
+		err := m.Scan1([]byte(tc.src))
+		if tc.ok && err != nil {
+			t.Fatalf("Error scanning %s: %s", tc.src, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrInvalidCount) {
+			t.Fatalf("%s: expected ErrInvalidCount, got %v", tc.src, err)
+		}
+	}
+
+	var tm TimeMetadata
+	parts := []sql.NullString{{String: "2020-01-02 03:04:05+00", Valid: true}, {String: "2020-01-02 03:04:05+00", Valid: true}}
+	if err := tm.scanFields(parts); !errors.Is(err, ErrInvalidCount) {
+		t.Fatalf("Expected ErrInvalidCount for missing deleted_at, got %v", err)
+	}
+	if err := tm.scanFields(append(parts, sql.NullString{})); err != nil || tm.DeletedAt != nil {
+		t.Fatalf("Unexpected TimeMetadata %+v (%v)", tm, err)
+	}
+}
+
+func TestUserOrganizationScanUnknownRole(t *testing.T) {
+	uo := UserOrganization{}
+	err := uo.Scan(`(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,superuser,"(,""2020-01-02 03:04:05+00"",""2020-01-02 03:04:05+00"",)")`)
+	if !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("Expected ErrInvalidRole, got %v", err)
+	}
+}
+
+func TestMetadataUnmarshalJSONOwnerKeys(t *testing.T) {
+	const ownerID = "00000000-0000-0000-0000-000000000001"
+	for _, src := range []string{
+		`{"owner_id":"` + ownerID + `","user_id":"00000000-0000-0000-0000-000000000002"}`,
+		`{"user_id":"00000000-0000-0000-0000-000000000002","owner_id":"` + ownerID + `"}`,
+		`{"owner_id":"` + ownerID + `","owner":{"user_id":"00000000-0000-0000-0000-000000000002"}}`,
+	} {
+		var m Metadata
+		if err := json.Unmarshal([]byte(src), &m); err != nil {
+			t.Fatalf("Error unmarshaling %s: %s", src, err)
+		}
+		if m.Owner == nil || m.Owner.ID.String() != ownerID {
+			t.Fatalf("%s: expected owner %s, got %v", src, ownerID, m.Owner)
+		}
+	}
+
+	// A stray user_id alone is not an owner.
+	var m Metadata
+	if err := json.Unmarshal([]byte(`{"user_id":"`+ownerID+`"}`), &m); err != nil || m.Owner != nil {
+		t.Fatalf("Expected no owner, got %v (%v)", m.Owner, err)
+	}
+}
+
+func TestTimeMetadataMarshalJSONEmpty(t *testing.T) {
+	var nilTM *TimeMetadata
+	for _, tc := range []struct {
+		name   string
+		v      interface{}
+		expect string
+	}{
+		{name: "value", v: TimeMetadata{}, expect: `{}`},
+		{name: "pointer", v: &TimeMetadata{}, expect: `{}`},
+		{name: "nil pointer", v: nilTM, expect: `null`},
+		{name: "field by value", v: struct{ TM TimeMetadata }{}, expect: `{"TM":{}}`},
+		{name: "field by pointer", v: struct{ TM *TimeMetadata }{TM: &TimeMetadata{}}, expect: `{"TM":{}}`},
+		{name: "nil field", v: struct{ TM *TimeMetadata }{}, expect: `{"TM":null}`},
+	} {
+		b, err := json.Marshal(tc.v)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tc.name, err)
+		}
+		if string(b) != tc.expect {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.expect, b)
+		}
+	}
+}
+
+func TestMetadataScanLooseResetsUsers(t *testing.T) {
+	for _, src := range []string{
+		`(,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`,
+		`("2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`,
+		`("2020-01-02 03:04:05+00","2020-01-02 03:04:05+00")`,
+	} {
+		m := Metadata{
+			Owner:     &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")},
+			CreatedBy: &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000002")},
+		}
+		if err := m.ScanLoose(src); err != nil {
+			t.Fatalf("Error scanning %s: %s", src, err)
+		}
+		if m.Owner != nil || m.CreatedBy != nil {
+			t.Fatalf("%s: expected no owner nor creator, got %v, %v", src, m.Owner, m.CreatedBy)
+		}
+		if m.CreatedAt.IsZero() || m.DeletedAt != nil {
+			t.Fatalf("%s: unexpected timestamps %v", src, m.TimeMetadata)
+		}
+	}
+}
+
+func TestUserRowToUser(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ownerID := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	for _, tc := range []struct {
+		name    string
+		ownerID *uuid.UUID
+		owned   bool
+	}{
+		{name: "null owner", ownerID: nil},
+		{name: "uuid_nil owner", ownerID: &NilUUID},
+		{name: "owner", ownerID: &ownerID, owned: true},
+	} {
+		row := UserRow{
+			UserID:    MustParseUUID("00000000-0000-0000-0000-000000000002"),
+			OwnerID:   tc.ownerID,
+			CreatedAt: ts,
+			UpdatedAt: ts,
+			DeletedAt: NullTime{Time: ts, Valid: true},
+		}
+		u := row.ToUser()
+		if owned := u.Metadata.Owner != nil; owned != tc.owned {
+			t.Fatalf("%s: unexpected owner %v", tc.name, u.Metadata.Owner)
+		}
+		if tc.owned && !uuid.Equal(u.Metadata.Owner.ID, ownerID) {
+			t.Fatalf("%s: unexpected owner id %s", tc.name, u.Metadata.Owner.ID)
+		}
+		if !u.Metadata.CreatedAt.Equal(Timestamp(ts)) || u.Metadata.DeletedAt == nil {
+			t.Fatalf("%s: unexpected timestamps %v", tc.name, u.Metadata.TimeMetadata)
+		}
+	}
+}
+
+func TestUserRowScan(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	owner := NewUser()
+	owned := NewUser()
+	owned.Metadata.Owner = owner
+	r := NewUserRepository(db)
+	for _, u := range []*User{owner, owned} {
+		if err := r.Insert(ctx, u); err != nil {
+			t.Fatalf("Error inserting user: %s", err)
+		}
+	}
+
+	rows := []UserRow{}
+	if err := db.SelectContext(ctx, &rows, db.Rebind(`
+SELECT user_id, owner_id, created_at, updated_at, deleted_at
+FROM users
+WHERE user_id IN (?, ?)
+ORDER BY created_at
+`), owner.ID, owned.ID); err != nil {
+		t.Fatalf("Error selecting user rows: %s", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Unexpected row count %d", len(rows))
+	}
+	if u := rows[0].ToUser(); u.Metadata.Owner != nil {
+		t.Fatalf("Unexpected owner for an ownerless user: %v", u.Metadata.Owner)
+	}
+	if u := rows[1].ToUser(); u.Metadata.Owner == nil || !uuid.Equal(u.Metadata.Owner.ID, owner.ID) {
+		t.Fatalf("Unexpected owner: %v", u.Metadata.Owner)
+	}
+}
+
+func TestMetadataScanJSONB(t *testing.T) {
+	var composite, jsonb Metadata
+	if err := composite.Scan1([]byte(`(00000000-0000-0000-0000-000000000001,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00","2020-01-03 03:04:05+00")`)); err != nil {
+		t.Fatalf("Error scanning the composite: %s", err)
+	}
+	src := ` {"owner_id":"00000000-0000-0000-0000-000000000001","created_at":"2020-01-02T03:04:05Z","updated_at":"2020-01-02T03:04:05+00:00","deleted_at":"2020-01-03T03:04:05Z"}`
+	if err := jsonb.Scan1([]byte(src)); err != nil {
+		t.Fatalf("Error scanning the jsonb %s: %s", src, err)
+	}
+	if !jsonb.Equal(composite) {
+		t.Fatalf("Expected the jsonb %v to match the composite %v", jsonb, composite)
+	}
+
+	if err := new(Metadata).Scan1([]byte(`{"created_at":`)); err == nil {
+		t.Fatal("Expected an error for a truncated jsonb")
+	}
+}
+
+func TestUserOrganizationsValueRoundTrip(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	uos := UserOrganizations{
+		{
+			UserID:         MustParseUUID("00000000-0000-0000-0000-00000000000a"),
+			OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000003"),
+			Role:           RoleMember,
+			Metadata:       Metadata{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}},
+		},
+		{
+			UserID:         MustParseUUID("00000000-0000-0000-0000-00000000000a"),
+			OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000001"),
+			Role:           RoleAdmin,
+			Metadata: Metadata{
+				Owner:        &User{ID: MustParseUUID("00000000-0000-0000-0000-00000000000b")},
+				TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts, DeletedAt: &ts},
+			},
+		},
+	}
+	v, err := uos.Value()
+	if err != nil {
+		t.Fatalf("Error encoding memberships: %s", err)
+	}
+	var got UserOrganizations
+	if err := got.Scan(v); err != nil {
+		t.Fatalf("Error scanning back %v: %s", v, err)
+	}
+	if len(got) != len(uos) {
+		t.Fatalf("Expected %d memberships, got %v", len(uos), got)
+	}
+	for i := range uos {
+		if !got[i].Equal(&uos[i]) {
+			t.Fatalf("Membership %d mismatch:\n%v\n%v", i, got[i], uos[i])
+		}
+	}
+
+	for _, empty := range []UserOrganizations{nil, {}} {
+		if v, err := empty.Value(); err != nil || v != "{}" {
+			t.Fatalf("Expected the empty array, got %v (%v)", v, err)
+		}
+	}
+}
+
+func TestMetadataScanHStore(t *testing.T) {
+	var composite, hstore Metadata
+	if err := composite.Scan1([]byte(`(00000000-0000-0000-0000-000000000001,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`)); err != nil {
+		t.Fatalf("Error scanning the composite: %s", err)
+	}
+	src := `"owner_id"=>"00000000-0000-0000-0000-000000000001", "created_at"=>"2020-01-02 03:04:05+00", "updated_at"=>"2020-01-02 03:04:05+00", "deleted_at"=>NULL, "extra"=>"ignored"`
+	if err := hstore.Scan1([]byte(src)); err != nil {
+		t.Fatalf("Error scanning the hstore %s: %s", src, err)
+	}
+	if !hstore.Equal(composite) || hstore.IsDeleted() {
+		t.Fatalf("Expected the hstore %v to match the composite %v", hstore, composite)
+	}
+
+	// The composites never look like an hstore, even with a `=>` in a field.
+	for _, src := range []string{`(,"a=>b",x,)`, `("a=>b")`, `{"a":"=>"}`} {
+		if isHStore([]byte(src)) {
+			t.Fatalf("Unexpected hstore detection of %s", src)
+		}
+	}
+	if !isHStore([]byte(` "owner_id"=>NULL`)) {
+		t.Fatal("Expected a padded hstore to be detected")
+	}
+}
+
+func TestMetadataCreatedBy(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	m := Metadata{
+		Owner:        &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")},
+		CreatedBy:    &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000002")},
+		TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts},
+	}
+
+	v, err := m.Value()
+	if err != nil {
+		t.Fatalf("Error encoding metadata: %s", err)
+	}
+	if s := v.(string); !strings.HasSuffix(s, ",00000000-0000-0000-0000-000000000002)") {
+		t.Fatalf("Expected a trailing created_by in %s", s)
+	}
+	var scanned Metadata
+	if err := scanned.Scan1(v); err != nil {
+		t.Fatalf("Error scanning back %v: %s", v, err)
+	}
+	if !scanned.Equal(m) || scanned.CreatedBy == nil || !uuid.Equal(scanned.CreatedBy.ID, m.CreatedBy.ID) {
+		t.Fatalf("Round trip mismatch:\n%v\n%v", scanned, m)
+	}
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Error marshaling metadata: %s", err)
+	}
+	for _, key := range []string{`"owner_id":"00000000-0000-0000-0000-000000000001"`, `"created_by":"00000000-0000-0000-0000-000000000002"`} {
+		if !strings.Contains(string(buf), key) {
+			t.Fatalf("Missing %s in %s", key, buf)
+		}
+	}
+	var decoded Metadata
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling %s: %s", buf, err)
+	}
+	if decoded.CreatedBy == nil || !uuid.Equal(decoded.CreatedBy.ID, m.CreatedBy.ID) || !uuid.Equal(decoded.Owner.ID, m.Owner.ID) {
+		t.Fatalf("Unexpected decoded metadata %+v", decoded)
+	}
+
+	// Without creator, the composite and the JSON are unchanged.
+	m.CreatedBy = nil
+	if v, _ := m.Value(); strings.Count(v.(string), ",") != 3 {
+		t.Fatalf("Unexpected composite without creator %v", v)
+	}
+	if buf, _ := json.Marshal(m); strings.Contains(string(buf), "created_by") {
+		t.Fatalf("Unexpected created_by in %s", buf)
+	}
+}
+
+func TestUserMarshalJSONWithoutMemberships(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	const golden = `{"user_id":"00000000-0000-0000-0000-000000000001","metadata":{"created_at":"2020-01-02T03:04:05.000000Z","updated_at":"2020-01-02T03:04:05.000000Z"}}`
+
+	// A scanned user gets empty, non-nil, membership slices.
+	for _, u := range []*User{
+		{Metadata: Metadata{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}}},
+		{Organizations: UserOrganizations{}, Teams: []UserTeam{}, Metadata: Metadata{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}}},
+	} {
+		u.ID = MustParseUUID("00000000-0000-0000-0000-000000000001")
+		buf, err := json.Marshal(u)
+		if err != nil {
+			t.Fatalf("Error marshaling user: %s", err)
+		}
+		if string(buf) != golden {
+			t.Fatalf("Unexpected JSON:\nexpected %s\ngot      %s", golden, buf)
+		}
+	}
+}
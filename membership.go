@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+// FindByOrg returns the membership of the given organization.
+// A nil organization id never matches.
+func (uos UserOrganizations) FindByOrg(orgID uuid.UUID) (*UserOrganization, bool) {
+	if orgID == nil {
+		return nil, false
+	}
+	for i := range uos {
+		if uuid.Equal(uos[i].OrganizationID, orgID) {
+			return &uos[i], true
+		}
+	}
+	return nil, false
+}
+
+// Sort orders the memberships by organization id, the order of UserQuery.OrderMemberships,
+// for a deterministic order when the query does not set it.
+func (uos UserOrganizations) Sort() {
+	sort.SliceStable(uos, func(i, j int) bool {
+		return bytes.Compare(uos[i].OrganizationID, uos[j].OrganizationID) < 0
+	})
+}
+
+// RoleIn returns the role of the user in the given organization.
+// ok is false when the user is not a member.
+func (u *User) RoleIn(orgID uuid.UUID) (role Role, ok bool) {
+	uo, ok := u.Organizations.FindByOrg(orgID)
+	if !ok {
+		return "", false
+	}
+	return uo.Role, true
+}
+
+// ReconcileMemberships checks that the organization and team memberships belong to the user,
+// catching the join bugs right after a scan.
+// A membership without user id is fixed by assigning it the user id,
+// while a membership of another user is left as is and reported as an ErrMemberMismatch.
+// Returns nil when all the memberships are consistent.
+func (u *User) ReconcileMemberships() []error {
+	var errs []error
+	for i := range u.Organizations {
+		uo := &u.Organizations[i]
+		if IsNil(uo.UserID) {
+			uo.UserID = u.ID
+		} else if !uuid.Equal(uo.UserID, u.ID) {
+			errs = append(errs, errors.Wrapf(ErrMemberMismatch,
+				"user %s in organization %s for user %s", uo.UserID, uo.OrganizationID, u.ID))
+		}
+	}
+	for i := range u.Teams {
+		ut := &u.Teams[i]
+		if IsNil(ut.UserID) {
+			ut.UserID = u.ID
+		} else if !uuid.Equal(ut.UserID, u.ID) {
+			errs = append(errs, errors.Wrapf(ErrMemberMismatch,
+				"user %s in team of organization %s for user %s", ut.UserID, ut.OrganizationID, u.ID))
+		}
+	}
+	return errs
+}
+
+// AddUser adds the given membership to the organization, assigning it the organization id when missing.
+// A user holds a single role per organization: adding a user already present returns ErrAlreadyMember,
+// change its role with SetRole instead.
+func (o *Organization) AddUser(uo *UserOrganization) error {
+	if uo.OrganizationID == nil {
+		uo.OrganizationID = o.ID
+	} else if !uuid.Equal(uo.OrganizationID, o.ID) {
+		return errors.Errorf("invalid organization_id %s for organization %s", uo.OrganizationID, o.ID)
+	}
+	if o.findUser(uo.UserID) != nil {
+		return errors.Wrapf(ErrAlreadyMember, "user %s in organization %s", uo.UserID, o.ID)
+	}
+	o.Users = append(o.Users, uo)
+	return nil
+}
+
+// SetRole changes the role of the given user in the organization and touches the membership.
+// Returns ErrNotMember if the user is not in the organization and ErrInvalidRole for an unknown role.
+func (o *Organization) SetRole(userID uuid.UUID, role Role) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	uo := o.findUser(userID)
+	if uo == nil {
+		return errors.Wrapf(ErrNotMember, "user %s in organization %s", userID, o.ID)
+	}
+	uo.Role = role
+	uo.Metadata.Touch()
+	return nil
+}
+
+// findUser returns the membership of the given user, nil if none.
+func (o *Organization) findUser(userID uuid.UUID) *UserOrganization {
+	for _, uo := range o.Users {
+		if uo != nil && uuid.Equal(uo.UserID, userID) {
+			return uo
+		}
+	}
+	return nil
+}
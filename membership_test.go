@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+func TestUserRoleIn(t *testing.T) {
+	org1 := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	org2 := MustParseUUID("00000000-0000-0000-0000-000000000002")
+	u := &User{Organizations: UserOrganizations{
+		{OrganizationID: org1, Role: RoleAdmin},
+		{OrganizationID: org2, Role: RoleViewer},
+	}}
+
+	for _, tc := range []struct {
+		orgID uuid.UUID
+		role  Role
+		ok    bool
+	}{
+		{orgID: MustParseUUID(org2.String()), role: RoleViewer, ok: true},
+		{orgID: org1, role: RoleAdmin, ok: true},
+		{orgID: MustParseUUID("00000000-0000-0000-0000-000000000003")},
+		{orgID: nil},
+	} {
+		role, ok := u.RoleIn(tc.orgID)
+		if role != tc.role || ok != tc.ok {
+			t.Fatalf("%v: expected %q, %t, got %q, %t", tc.orgID, tc.role, tc.ok, role, ok)
+		}
+	}
+
+	uo, ok := u.Organizations.FindByOrg(org2)
+	if !ok {
+		t.Fatal("Expected to find the membership")
+	}
+	uo.Role = RoleMember
+	if u.Organizations[1].Role != RoleMember {
+		t.Fatal("Expected FindByOrg to return the membership in place")
+	}
+}
+
+func TestOrganizationAddUserSetRole(t *testing.T) {
+	o := NewOrganization()
+	userID := MustParseUUID("00000000-0000-0000-0000-000000000001")
+
+	uo := &UserOrganization{UserID: userID, Role: RoleMember}
+	if err := o.AddUser(uo); err != nil {
+		t.Fatalf("Unexpected error adding user: %s", err)
+	}
+	if !uuid.Equal(uo.OrganizationID, o.ID) {
+		t.Fatalf("Expected the organization_id to be set, got %s", uo.OrganizationID)
+	}
+	if err := o.AddUser(&UserOrganization{UserID: userID, Role: RoleAdmin}); errors.Cause(err) != ErrAlreadyMember {
+		t.Fatalf("Expected ErrAlreadyMember, got %v", err)
+	}
+	if err := o.AddUser(&UserOrganization{UserID: newUUID(), OrganizationID: newUUID(), Role: RoleMember}); err == nil {
+		t.Fatal("Expected an error adding a membership of another organization")
+	}
+	if len(o.Users) != 1 || o.Users[0].Role != RoleMember {
+		t.Fatalf("Unexpected users %v", o.Users)
+	}
+
+	if err := o.SetRole(userID, RoleAdmin); err != nil {
+		t.Fatalf("Unexpected error changing role: %s", err)
+	}
+	if o.Users[0].Role != RoleAdmin || o.Users[0].Metadata.UpdatedAt.IsZero() {
+		t.Fatalf("Expected a touched admin membership, got %+v", o.Users[0])
+	}
+	if err := o.SetRole(userID, Role("root")); errors.Cause(err) != ErrInvalidRole {
+		t.Fatalf("Expected ErrInvalidRole, got %v", err)
+	}
+	if err := o.SetRole(newUUID(), RoleAdmin); errors.Cause(err) != ErrNotMember {
+		t.Fatalf("Expected ErrNotMember, got %v", err)
+	}
+}
+
+func TestUserOrganizationsSort(t *testing.T) {
+	const metadata = `\"(,\"\"2020-01-02 03:04:05+00\"\",\"\"2020-01-02 03:04:05+00\"\",)\"`
+	agg := `{"(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-000000000003,member,` + metadata + `)",` +
+		`"(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-000000000001,admin,` + metadata + `)",` +
+		`"(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-000000000002,viewer,` + metadata + `)"}`
+	var uos UserOrganizations
+	if err := uos.Scan(agg); err != nil {
+		t.Fatalf("Error scanning %s: %s", agg, err)
+	}
+
+	uos.Sort()
+	for i, uo := range uos {
+		if expect := MustParseUUID(fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1)); !uuid.Equal(uo.OrganizationID, expect) {
+			t.Fatalf("Expected %s at %d, got %s", expect, i, uo.OrganizationID)
+		}
+	}
+	if uos[0].Role != RoleAdmin || uos[2].Role != RoleMember {
+		t.Fatalf("Expected the roles to follow their memberships, got %v", uos)
+	}
+
+	if query := (UserQuery{OrderMemberships: true}).String(); !strings.Contains(query, " ORDER BY uoj.organization_id)") {
+		t.Fatalf("Missing the memberships ordering in:\n%s", query)
+	}
+	if query := (UserQuery{}).String(); strings.Contains(query, "ORDER BY uoj.organization_id") {
+		t.Fatalf("Unexpected memberships ordering in:\n%s", query)
+	}
+}
+
+func TestUserReconcileMemberships(t *testing.T) {
+	userID := MustParseUUID("00000000-0000-0000-0000-00000000000a")
+	other := MustParseUUID("00000000-0000-0000-0000-00000000000f")
+	u := &User{
+		ID: userID,
+		Organizations: UserOrganizations{
+			{UserID: userID, OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000001"), Role: RoleMember},
+			{OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000002"), Role: RoleMember},
+			{UserID: other, OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000003"), Role: RoleAdmin},
+		},
+		Teams: []UserTeam{
+			{UserID: NilUUID, OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000001"), Role: RoleMember},
+			{UserID: other, OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000001"), Role: RoleMember},
+		},
+	}
+
+	errs := u.ReconcileMemberships()
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 mismatches, got %v", errs)
+	}
+	for _, err := range errs {
+		if errors.Cause(err) != ErrMemberMismatch {
+			t.Fatalf("Expected ErrMemberMismatch, got %v", err)
+		}
+	}
+	if !uuid.Equal(u.Organizations[1].UserID, userID) || !uuid.Equal(u.Teams[0].UserID, userID) {
+		t.Fatalf("Expected the missing user ids to be fixed, got %v, %v", u.Organizations[1], u.Teams[0])
+	}
+	if !uuid.Equal(u.Organizations[2].UserID, other) || !uuid.Equal(u.Teams[1].UserID, other) {
+		t.Fatal("Expected the mismatches to be left as is")
+	}
+
+	if errs := u.ReconcileMemberships(); len(errs) != 2 {
+		t.Fatalf("Expected the mismatches to be reported again, got %v", errs)
+	}
+	u.Organizations, u.Teams = u.Organizations[:2], u.Teams[:1]
+	if errs := u.ReconcileMemberships(); errs != nil {
+		t.Fatalf("Expected consistent memberships, got %v", errs)
+	}
+}
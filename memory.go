@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+// MemoryUserStore is an in-memory UserStore, to test against the models without postgres.
+// It mirrors UserRepository: soft-deleted users are not returned
+// and a missing user is reported as sql.ErrNoRows.
+// The users are cloned on the way in and out, so callers never share state with the store.
+type MemoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+var (
+	_ UserStore = (*UserRepository)(nil)
+	_ UserStore = (*MemoryUserStore)(nil)
+)
+
+// NewMemoryUserStore instantiates an empty MemoryUserStore.
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: map[string]*User{}}
+}
+
+// GetByID returns a copy of the user with the given id.
+func (s *MemoryUserStore) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id.String()]
+	if !ok || u.Metadata.IsDeleted() {
+		return nil, errors.Wrapf(sql.ErrNoRows, "error get user %s", id)
+	}
+	return u.Clone(), nil
+}
+
+// Insert stores a copy of the given user.
+// A random user_id is assigned when missing and the timestamps are touched.
+func (s *MemoryUserStore) Insert(ctx context.Context, u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.ID == nil {
+		u.ID = newUUID()
+	}
+	if _, ok := s.users[u.ID.String()]; ok {
+		return errors.Errorf("error insert user: duplicate user_id %s", u.ID)
+	}
+	u.Metadata.Touch()
+	s.users[u.ID.String()] = u.Clone()
+	return nil
+}
+
+// SoftDelete marks the user with the given id as deleted.
+// Deleting an already deleted or a missing user is a no-op.
+func (s *MemoryUserStore) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id.String()]
+	if !ok || u.Metadata.IsDeleted() {
+		return nil
+	}
+	u.Metadata.Delete()
+	u.Metadata.UpdatedAt = Now()
+	return nil
+}
+
+// ListUsers returns copies of up to limit users, ordered by creation, starting after the given cursor.
+// See UserRepository.ListUsers.
+func (s *MemoryUserStore) ListUsers(ctx context.Context, cursor Cursor, limit int) ([]*User, Cursor, error) {
+	if limit <= 0 {
+		return nil, "", errors.Errorf("invalid limit %d", limit)
+	}
+	var after *cursorPosition
+	if cursor != "" {
+		pos, err := cursor.decode()
+		if err != nil {
+			return nil, "", err
+		}
+		after = &pos
+	}
+
+	s.mu.RLock()
+	users := make([]*User, 0, len(s.users))
+	for _, u := range s.users {
+		if u.Metadata.IsDeleted() {
+			continue
+		}
+		if after != nil && !userAfter(u, after.CreatedAt, after.UserID) {
+			continue
+		}
+		users = append(users, u.Clone())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return userAfter(users[j], users[i].Metadata.CreatedAt.Time(), users[i].ID)
+	})
+	if len(users) <= limit {
+		return users, "", nil
+	}
+	users = users[:limit]
+	next, err := newCursor(users[limit-1])
+	if err != nil {
+		return nil, "", err
+	}
+	return users, next, nil
+}
+
+// userAfter reports whether the user comes after the given position in the (created_at, user_id) order.
+func userAfter(u *User, createdAt time.Time, id uuid.UUID) bool {
+	if t := u.Metadata.CreatedAt.Time(); !t.Equal(createdAt) {
+		return t.After(createdAt)
+	}
+	return u.ID.String() > id.String()
+}
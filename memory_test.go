@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+func TestMemoryUserStore(t *testing.T) {
+	s := NewMemoryUserStore()
+	ctx := context.Background()
+
+	u := NewUser()
+	u.Organizations = UserOrganizations{{OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000001"), Role: RoleMember}}
+	if err := s.Insert(ctx, u); err != nil {
+		t.Fatalf("Error inserting user: %s", err)
+	}
+	if err := s.Insert(ctx, u); err == nil {
+		t.Fatal("Expected an error inserting a duplicate user")
+	}
+
+	got, err := s.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Error getting user: %s", err)
+	}
+	if !got.Equal(u) {
+		t.Fatalf("Expected %v, got %v", u, got)
+	}
+
+	// Copy on read: mutating the returned user does not alter the store.
+	got.Organizations[0].Role = RoleAdmin
+	if again, _ := s.GetByID(ctx, u.ID); again.Organizations[0].Role != RoleMember {
+		t.Fatalf("Expected the stored user unchanged, got %v", again.Organizations)
+	}
+
+	if err := s.SoftDelete(ctx, u.ID); err != nil {
+		t.Fatalf("Error soft deleting user: %s", err)
+	}
+	if _, err := s.GetByID(ctx, u.ID); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("Expected sql.ErrNoRows for a deleted user, got %v", err)
+	}
+	if _, err := s.GetByID(ctx, uuid.NewRandom()); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("Expected sql.ErrNoRows for a missing user, got %v", err)
+	}
+	if err := s.SoftDelete(ctx, uuid.NewRandom()); err != nil {
+		t.Fatalf("Expected deleting a missing user to be a no-op, got %s", err)
+	}
+}
+
+func TestMemoryUserStoreListUsers(t *testing.T) {
+	s := NewMemoryUserStore()
+	ctx := context.Background()
+
+	ids := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		u := NewUser()
+		if err := s.Insert(ctx, u); err != nil {
+			t.Fatalf("Error inserting user: %s", err)
+		}
+		ids[u.ID.String()] = true
+	}
+	deleted := NewUser()
+	if err := s.Insert(ctx, deleted); err != nil {
+		t.Fatalf("Error inserting user: %s", err)
+	}
+	if err := s.SoftDelete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Error soft deleting user: %s", err)
+	}
+
+	var cursor Cursor
+	seen := map[string]bool{}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Too many pages")
+		}
+		users, next, err := s.ListUsers(ctx, cursor, 2)
+		if err != nil {
+			t.Fatalf("Error listing users: %s", err)
+		}
+		for _, u := range users {
+			if seen[u.ID.String()] || !ids[u.ID.String()] {
+				t.Fatalf("Unexpected user %s", u.ID)
+			}
+			seen[u.ID.String()] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != len(ids) {
+		t.Fatalf("Expected %d users, got %d", len(ids), len(seen))
+	}
+
+	if _, _, err := s.ListUsers(ctx, "", 0); err == nil {
+		t.Fatal("Expected an error for a zero limit")
+	}
+}
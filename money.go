@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql/driver"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Money is an amount of a currency, in the currency minor units, i.e. cents,
+// so the arithmetic is exact unlike with float costs.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MoneyFromFloat returns the Money of the given amount, rounded to the currency minor unit.
+// Unknown currencies are rejected with ErrInvalidCurrency.
+func MoneyFromFloat(f float64, currency string) (Money, error) {
+	code, err := ParseCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: toMinorUnits(f, code), Currency: code}, nil
+}
+
+// Float returns the amount in the currency major unit, i.e. 19.99 for 1999 USD cents.
+func (m Money) Float() float64 {
+	return fromMinorUnits(m.Amount, m.Currency)
+}
+
+// Add returns the sum of both amounts.
+// Amounts of different currencies are rejected with ErrInvalidCurrency.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, errors.Wrapf(ErrInvalidCurrency, "cannot add %s to %s", other.Currency, m.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// CostMoney returns the cost of the plan as Money, with the normalized currency code,
+// so it adds up with the Money of the same currency whatever its case.
+func (pp *PaymentPlan) CostMoney() Money {
+	currency := normalizeCurrency(pp.Currency)
+	return Money{Amount: toMinorUnits(pp.Cost, currency), Currency: currency}
+}
+
+// Scan implements sql.Scanner interface.
+// It expects a `(amount,currency)` composite, the amount being in minor units.
+func (m *Money) Scan(src interface{}) error {
+	b, err := scanToBytes(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for Money scan")
+	}
+
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing Money composite")
+	}
+	if len(parts) != 2 {
+		return countError("Money", 2, len(parts), string(b))
+	}
+
+	if m.Amount, err = strconv.ParseInt(parts[0].String, 10, 64); err != nil {
+		return errors.Wrap(err, "invalid amount")
+	}
+	if m.Currency, err = ParseCurrency(parts[1].String); err != nil {
+		return errors.Wrap(err, "invalid currency")
+	}
+	return nil
+}
+
+// Value implements driver.Valuer interface.
+// It emits the `(amount,currency)` composite expected by Scan.
+func (m Money) Value() (driver.Value, error) {
+	return "(" + strconv.FormatInt(m.Amount, 10) + "," + encodeCompositeField(m.Currency) + ")", nil
+}
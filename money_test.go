@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestPaymentPlanCostMoney(t *testing.T) {
+	for _, currency := range []string{"usd", " Usd ", "USD"} {
+		pp := PaymentPlan{Cost: 19.99, Currency: currency}
+		m := pp.CostMoney()
+		if m != (Money{Amount: 1999, Currency: "USD"}) {
+			t.Fatalf("%q: unexpected money %v", currency, m)
+		}
+		if _, err := m.Add(Money{Amount: 1, Currency: "USD"}); err != nil {
+			t.Fatalf("%q: unexpected error adding USD: %s", currency, err)
+		}
+	}
+
+	pp := PaymentPlan{Cost: 1000, Currency: "jpy"}
+	if m := pp.CostMoney(); m != (Money{Amount: 1000, Currency: "JPY"}) {
+		t.Fatalf("Unexpected JPY money %v", m)
+	}
+}
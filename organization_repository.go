@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// OrganizationRepository handles the Organization persistence.
+type OrganizationRepository struct {
+	repository
+}
+
+// NewOrganizationRepository instantiates a new OrganizationRepository on top of the given db.
+func NewOrganizationRepository(db *sqlx.DB, opts ...RepositoryOption) *OrganizationRepository {
+	return &OrganizationRepository{repository: newRepository(db, opts...)}
+}
+
+// organizationRow is the organizations row along with the aggregated members and teams, as selected by GetByID.
+type organizationRow struct {
+	ID        uuid.UUID         `db:"organization_id"`
+	Users     OrganizationUsers `db:"users"`
+	Teams     Teams             `db:"teams"`
+	OwnerID   uuid.UUID         `db:"owner_id"`
+	CreatedAt time.Time         `db:"created_at"`
+	UpdatedAt time.Time         `db:"updated_at"`
+	DeletedAt NullTime          `db:"deleted_at"`
+}
+
+// GetByID fetches the organization with the given id along with its members and teams, in one query.
+// The members are ordered by user_id and the teams by name.
+// An organization without members or teams gets empty, non-nil, Users and Teams.
+// The teams users and the organization payment plan are not loaded.
+// Returns sql.ErrNoRows, wrapped, if there is no such organization.
+func (r *OrganizationRepository) GetByID(ctx context.Context, id uuid.UUID) (*Organization, error) {
+	const queryGetOrganization = `
+SELECT
+  o.organization_id,
+  COALESCE((
+    SELECT array_agg(` + membershipComposite + ` ORDER BY uoj.user_id)
+    FROM user_organization_join uoj
+    WHERE uoj.organization_id = o.organization_id%[1]s
+  ), '{}') AS "users",
+  COALESCE((
+    SELECT array_agg(` + teamComposite + ` ORDER BY t.name)
+    FROM teams t
+    WHERE t.organization_id = o.organization_id%[2]s
+  ), '{}') AS "teams",
+  o.owner_id,
+  o.created_at,
+  o.updated_at,
+  o.deleted_at
+FROM organizations o
+WHERE o.organization_id = ?%[3]s
+`
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	query := fmt.Sprintf(queryGetOrganization, "", "", "")
+	if !r.includeDeleted {
+		query = fmt.Sprintf(queryGetOrganization,
+			" AND uoj.deleted_at IS NULL",
+			" AND t.deleted_at IS NULL",
+			" AND o.deleted_at IS NULL",
+		)
+	}
+	row := organizationRow{}
+	if err := r.db.GetContext(ctx, &row, r.db.Rebind(query), id); err != nil {
+		return nil, errors.Wrapf(err, "error get organization %s", id)
+	}
+
+	o := &Organization{
+		ID:    row.ID,
+		Users: row.Users,
+		Teams: row.Teams,
+	}
+	if o.Users == nil {
+		o.Users = OrganizationUsers{}
+	}
+	if o.Teams == nil {
+		o.Teams = Teams{}
+	}
+	if !IsNil(row.OwnerID) {
+		o.Metadata.Owner = &User{ID: row.OwnerID}
+	}
+	o.Metadata.CreatedAt = Timestamp(row.CreatedAt)
+	o.Metadata.UpdatedAt = Timestamp(row.UpdatedAt)
+	o.Metadata.DeletedAt = row.DeletedAt.TimestampPtr()
+	return o, nil
+}
+
+// AddTeam creates the given team within the organization with the given id.
+// The team organization is set, a random team_id is assigned when missing,
+// a NULL capacity defaults to 0, no limit, and the timestamps are touched.
+// Returns ErrDuplicateTeamName if the organization already has a team with the same name.
+func (r *OrganizationRepository) AddTeam(ctx context.Context, orgID uuid.UUID, t *Team) error {
+	const queryInsertTeam = `
+INSERT INTO teams (
+  team_id,
+  organization_id,
+  name,
+  capacity,
+  owner_id,
+  created_at,
+  updated_at,
+  deleted_at
+) VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
+`
+	if IsNil(orgID) {
+		return errors.New("invalid organization_id for team")
+	}
+	t.Organization = &Organization{ID: orgID}
+	if IsNil(t.ID) {
+		t.ID = newUUID()
+	}
+	if t.CapacityNull {
+		t.Capacity, t.CapacityNull = 0, false
+	}
+	if err := t.Validate(); err != nil {
+		return errors.Wrap(err, "invalid team")
+	}
+	t.Metadata.Touch()
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	// Ownerless teams are stored with a NULL owner_id.
+	var ownerID interface{}
+	if t.Metadata.Owner != nil {
+		ownerID = t.Metadata.Owner.ID
+	}
+
+	if _, err := r.ext().ExecContext(ctx, r.db.Rebind(queryInsertTeam),
+		t.ID,
+		orgID,
+		t.Name,
+		t.Capacity,
+		ownerID,
+		t.Metadata.CreatedAt,
+		t.Metadata.UpdatedAt,
+		t.Metadata.DeletedAt,
+	); err != nil {
+		if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Constraint == "teams_organization_id_name_key" {
+			return errors.Wrapf(ErrDuplicateTeamName, "team %q in organization %s", t.Name, orgID)
+		}
+		return errors.Wrap(wrapPQError(err), "error insert team")
+	}
+	return nil
+}
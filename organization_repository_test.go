@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/creack/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestAddTeamDefaults(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewOrganizationRepository(sqlx.NewDb(nil, "postgres"), WithDryRun(&buf))
+	orgID := MustParseUUID("00000000-0000-0000-0000-00000000000b")
+
+	team := &Team{Name: "devs", Capacity: 5, CapacityNull: true}
+	if err := r.AddTeam(context.Background(), orgID, team); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if team.Organization == nil || !uuid.Equal(team.Organization.ID, orgID) {
+		t.Fatalf("Unexpected organization %v", team.Organization)
+	}
+	if IsNil(team.ID) || team.Capacity != 0 || team.CapacityNull {
+		t.Fatalf("Unexpected team defaults %v", team)
+	}
+	if team.Metadata.CreatedAt.IsZero() || team.Metadata.UpdatedAt.IsZero() {
+		t.Fatalf("Expected the timestamps to be touched, got %+v", team.Metadata.TimeMetadata)
+	}
+	if buf.Len() == 0 {
+		t.Fatal("Expected the insert statement to be printed")
+	}
+
+	for _, tc := range []struct {
+		orgID uuid.UUID
+		team  *Team
+	}{
+		{NilUUID, &Team{Name: "devs"}},
+		{orgID, &Team{}},
+		{orgID, &Team{Name: "devs", Capacity: -1}},
+	} {
+		if err := r.AddTeam(context.Background(), tc.orgID, tc.team); err == nil {
+			t.Fatalf("Expected an error adding %v to %s", tc.team, tc.orgID)
+		}
+	}
+}
+
+func TestAddTeamDuplicateName(t *testing.T) {
+	db := openTestDB(t)
+	r := NewOrganizationRepository(db)
+	ctx := context.Background()
+	o := insertTestOrganization(t, db)
+
+	if err := r.AddTeam(ctx, o.ID, &Team{Name: "devs", Capacity: 2}); err != nil {
+		t.Fatalf("Error adding team: %s", err)
+	}
+	if err := r.AddTeam(ctx, o.ID, &Team{Name: "devs"}); errors.Cause(err) != ErrDuplicateTeamName {
+		t.Fatalf("Expected ErrDuplicateTeamName, got %v", err)
+	}
+	if err := r.AddTeam(ctx, insertTestOrganization(t, db).ID, &Team{Name: "devs"}); err != nil {
+		t.Fatalf("Expected the same name in another organization to be accepted, got %s", err)
+	}
+
+	got, err := r.GetByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("Error getting organization: %s", err)
+	}
+	if len(got.Teams) != 1 || got.Teams[0].Name != "devs" || got.Teams[0].Capacity != 2 {
+		t.Fatalf("Unexpected teams %v", got.Teams)
+	}
+}
+
+func TestOrganizationRepositoryGetByID(t *testing.T) {
+	db := openTestDB(t)
+	r := NewOrganizationRepository(db)
+	ctx := context.Background()
+
+	empty := insertTestOrganization(t, db)
+	got, err := r.GetByID(ctx, empty.ID)
+	if err != nil {
+		t.Fatalf("Error getting an empty organization: %s", err)
+	}
+	if got.Users == nil || len(got.Users) != 0 || got.Teams == nil || len(got.Teams) != 0 {
+		t.Fatalf("Expected empty users and teams, got %#v, %#v", got.Users, got.Teams)
+	}
+
+	o := insertTestOrganization(t, db)
+	users := NewUserRepository(db)
+	for _, role := range []Role{RoleOwner, RoleMember} {
+		u := NewUser()
+		u.Organizations = UserOrganizations{{OrganizationID: o.ID, Role: role, Metadata: testOwnerMetadata()}}
+		if err := users.InsertWithMemberships(ctx, u); err != nil {
+			t.Fatalf("Error inserting user: %s", err)
+		}
+	}
+	for _, name := range []string{"ops", "devs"} {
+		if err := r.AddTeam(ctx, o.ID, &Team{Name: name}); err != nil {
+			t.Fatalf("Error adding team: %s", err)
+		}
+	}
+
+	got, err = r.GetByID(ctx, o.ID)
+	if err != nil {
+		t.Fatalf("Error getting organization: %s", err)
+	}
+	// The test organizations are owned by the uuid_nil user, which means no owner.
+	if !uuid.Equal(got.ID, o.ID) || got.Metadata.Owner != nil || got.Metadata.CreatedAt.IsZero() {
+		t.Fatalf("Unexpected organization %v", got)
+	}
+	if len(got.Users) != 2 {
+		t.Fatalf("Expected 2 users, got %v", got.Users)
+	}
+	if len(got.Teams) != 2 || got.Teams[0].Name != "devs" || got.Teams[1].Name != "ops" {
+		t.Fatalf("Expected the teams ordered by name, got %v", got.Teams)
+	}
+
+	if _, err := r.GetByID(ctx, uuid.NewRandom()); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
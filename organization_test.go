@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOrganizationMarshalJSONGolden(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	metadata := Metadata{
+		Owner:        &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")},
+		TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts},
+	}
+	orgID := MustParseUUID("00000000-0000-0000-0000-00000000000b")
+	o := &Organization{ID: orgID, Metadata: metadata}
+	o.Users = OrganizationUsers{{
+		UserID:         MustParseUUID("00000000-0000-0000-0000-000000000002"),
+		OrganizationID: orgID,
+		Role:           RoleOwner,
+		Metadata:       metadata,
+	}}
+	o.Teams = Teams{{
+		ID:           MustParseUUID("00000000-0000-0000-0000-00000000000c"),
+		Organization: o,
+		Name:         "core",
+		Capacity:     5,
+		Users: TeamUsers{{
+			UserID:         MustParseUUID("00000000-0000-0000-0000-000000000002"),
+			OrganizationID: orgID,
+			Role:           RoleMember,
+			Metadata:       metadata,
+		}},
+		Metadata: metadata,
+	}}
+	o.PaymentPlan = &PaymentPlan{
+		ID:       MustParseUUID("00000000-0000-0000-0000-00000000000d"),
+		Name:     "team",
+		Cost:     49.5,
+		Currency: "EUR",
+		Term:     TermYearly,
+		Metadata: metadata,
+	}
+
+	buf, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("Error marshaling organization: %s", err)
+	}
+	var got bytes.Buffer
+	if err := json.Indent(&got, buf, "", "  "); err != nil {
+		t.Fatalf("Error indenting %s: %s", buf, err)
+	}
+	got.WriteByte('\n')
+
+	golden, err := os.ReadFile("testdata/organization.json")
+	if err != nil {
+		t.Fatalf("Error reading the golden file: %s", err)
+	}
+	if !bytes.Equal(got.Bytes(), golden) {
+		t.Fatalf("Unexpected JSON:\n%s\nexpected:\n%s", got.Bytes(), golden)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+// Term is the billing period of a payment plan.
+type Term string
+
+// Known terms.
+const (
+	TermDaily   Term = "Daily"
+	TermWeekly  Term = "Weekly"
+	TermMonthly Term = "Monthly"
+	TermYearly  Term = "Yearly"
+)
+
+// Valid returns true if the term is one of the known terms.
+func (t Term) Valid() bool {
+	switch t {
+	case TermDaily, TermWeekly, TermMonthly, TermYearly:
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseTerm returns the Term for the given string.
+// Unknown terms are rejected with ErrInvalidTerm.
+func ParseTerm(s string) (Term, error) {
+	t := Term(s)
+	if !t.Valid() {
+		return "", errors.Wrapf(ErrInvalidTerm, "unknown term %q", s)
+	}
+	return t, nil
+}
+
+// Period returns the duration of the term.
+// Months and years are approximated to 30 and 365 days.
+// Returns 0 for an unknown term.
+func (t Term) Period() time.Duration {
+	const day = 24 * time.Hour
+
+	switch t {
+	case TermDaily:
+		return day
+	case TermWeekly:
+		return 7 * day
+	case TermMonthly:
+		return 30 * day
+	case TermYearly:
+		return 365 * day
+	default:
+		return 0
+	}
+}
+
+// NewPaymentPlan instantiates a new PaymentPlan with a random id and fresh timestamps.
+// The plan is not validated, see Validate.
+func NewPaymentPlan(name string, cost float64, currency string, term Term) *PaymentPlan {
+	pp := &PaymentPlan{
+		ID:       newUUID(),
+		Name:     name,
+		Cost:     cost,
+		Currency: currency,
+		Term:     term,
+	}
+	pp.Metadata.Touch()
+	return pp
+}
+
+// Validate implements Validator interface.
+// It checks the payment plan term, cost and currency.
+func (pp *PaymentPlan) Validate() error {
+	v := validation{}
+	v.checkUUID("payment_plan_id", pp.ID)
+	if _, err := ParseTerm(string(pp.Term)); err != nil {
+		v.check("term", err)
+	}
+	if pp.Cost < 0 {
+		v.check("cost", errors.Errorf("invalid negative cost %v", pp.Cost))
+	}
+	if _, err := ParseCurrency(pp.Currency); err != nil {
+		v.check("currency", err)
+	}
+	v.check("", pp.Metadata.Validate())
+	return v.err()
+}
+
+// Scan implements sql.Scanner interface.
+// It expects a `(payment_plan_id,name,cost,currency,term,owner_id,created_at,updated_at,deleted_at)` composite,
+// optionally followed by the metadata created_by.
+// A NULL plan leaves pp untouched: when scanning into a *PaymentPlan field, database/sql keeps the pointer nil.
+func (pp *PaymentPlan) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	b, err := scanToBytes(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for PaymentPlan scan")
+	}
+
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing PaymentPlan composite")
+	}
+	if len(parts) != 9 && len(parts) != 10 {
+		return countError("PaymentPlan", 9, len(parts), string(b))
+	}
+
+	pp.ID = uuid.Parse(parts[0].String)
+	if pp.ID == nil {
+		return errors.New("invalid payment_plan_id")
+	}
+	pp.Name = parts[1].String
+	if pp.Cost, err = strconv.ParseFloat(parts[2].String, 64); err != nil {
+		return errors.Wrap(err, "invalid cost")
+	}
+	if pp.Currency, err = ParseCurrency(parts[3].String); err != nil {
+		return errors.Wrap(err, "invalid currency")
+	}
+	if pp.Term, err = ParseTerm(parts[4].String); err != nil {
+		return errors.Wrap(err, "invalid term")
+	}
+	if err := pp.Metadata.scanFields(parts[5:]); err != nil {
+		return errors.Wrap(err, "error scan Metadata for PaymentPlan")
+	}
+	if StrictScan {
+		if err := pp.Validate(); err != nil {
+			return errors.Wrap(err, "invalid PaymentPlan")
+		}
+	}
+
+	return nil
+}
+
+// Value implements driver.Valuer interface.
+// It emits the `(payment_plan_id,name,cost,currency,term,owner_id,created_at,updated_at,deleted_at)` composite
+// expected by Scan, followed by created_by when set. Without it, the Value promoted from the embedded Metadata
+// would emit the metadata alone.
+func (pp PaymentPlan) Value() (driver.Value, error) {
+	if pp.ID == nil {
+		return nil, errors.New("invalid payment_plan_id for PaymentPlan value")
+	}
+	metadata, err := pp.Metadata.compositeFields()
+	if err != nil {
+		return nil, errors.Wrap(err, "error value Metadata for PaymentPlan")
+	}
+	fields := append([]string{
+		pp.ID.String(),
+		encodeCompositeField(pp.Name),
+		strconv.FormatFloat(pp.Cost, 'f', -1, 64),
+		encodeCompositeField(pp.Currency),
+		encodeCompositeField(string(pp.Term)),
+	}, metadata...)
+	return "(" + strings.Join(fields, ",") + ")", nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// PaymentPlanRepository handles the PaymentPlan persistence.
+// The cost is stored as an integer number of the currency minor units, see toMinorUnits,
+// so it round-trips exactly while PaymentPlan.Cost stays a float.
+type PaymentPlanRepository struct {
+	repository
+}
+
+// NewPaymentPlanRepository instantiates a new PaymentPlanRepository on top of the given db.
+func NewPaymentPlanRepository(db *sqlx.DB, opts ...RepositoryOption) *PaymentPlanRepository {
+	return &PaymentPlanRepository{repository: newRepository(db, opts...)}
+}
+
+// paymentPlanRow is the payment_plans row.
+type paymentPlanRow struct {
+	ID        uuid.UUID  `db:"payment_plan_id"`
+	Name      string     `db:"name"`
+	CostMinor int64      `db:"cost_minor"`
+	Currency  string     `db:"currency"`
+	Term      string     `db:"term"`
+	OwnerID   *uuid.UUID `db:"owner_id"` // Nil when NULL.
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	DeletedAt NullTime   `db:"deleted_at"`
+}
+
+// toPaymentPlan returns the PaymentPlan of the row.
+// A NULL or `uuid_nil()` owner_id means no owner.
+func (row paymentPlanRow) toPaymentPlan() (*PaymentPlan, error) {
+	term, err := ParseTerm(row.Term)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid term for payment plan %s", row.ID)
+	}
+	pp := &PaymentPlan{
+		ID:       row.ID,
+		Name:     row.Name,
+		Cost:     fromMinorUnits(row.CostMinor, row.Currency),
+		Currency: row.Currency,
+		Term:     term,
+	}
+	if row.OwnerID != nil && !IsNil(*row.OwnerID) {
+		pp.Owner = &User{ID: *row.OwnerID}
+	}
+	pp.CreatedAt = Timestamp(row.CreatedAt)
+	pp.UpdatedAt = Timestamp(row.UpdatedAt)
+	pp.DeletedAt = row.DeletedAt.TimestampPtr()
+	return pp, nil
+}
+
+// Get fetches the payment plan with the given id.
+func (r *PaymentPlanRepository) Get(ctx context.Context, id uuid.UUID) (*PaymentPlan, error) {
+	const queryGetPaymentPlan = `
+SELECT
+  payment_plan_id,
+  name,
+  cost_minor,
+  currency,
+  term,
+  owner_id,
+  created_at,
+  updated_at,
+  deleted_at
+FROM payment_plans
+WHERE payment_plan_id = ?
+`
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	query := queryGetPaymentPlan
+	if !r.includeDeleted {
+		query += "  AND deleted_at IS NULL\n"
+	}
+	row := paymentPlanRow{}
+	if err := r.db.GetContext(ctx, &row, r.db.Rebind(query), id); err != nil {
+		return nil, errors.Wrapf(err, "error get payment plan %s", id)
+	}
+	return row.toPaymentPlan()
+}
+
+// Insert creates the given payment plan.
+// A random payment_plan_id is assigned when missing and the timestamps are touched.
+// The plan is validated first and its currency code normalized, i.e. "usd" is stored as "USD".
+func (r *PaymentPlanRepository) Insert(ctx context.Context, pp *PaymentPlan) error {
+	const queryInsertPaymentPlan = `
+INSERT INTO payment_plans (
+  payment_plan_id,
+  name,
+  cost_minor,
+  currency,
+  term,
+  owner_id,
+  created_at,
+  updated_at,
+  deleted_at
+) VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
+`
+	if pp.ID == nil {
+		pp.ID = newUUID()
+	}
+	if err := pp.Validate(); err != nil {
+		return errors.Wrap(err, "invalid payment plan")
+	}
+	// Validate accepted the currency, store its normalized code.
+	pp.Currency, _ = ParseCurrency(pp.Currency)
+	pp.Metadata.Touch()
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	// Ownerless plans are stored with a NULL owner_id.
+	var ownerID interface{}
+	if pp.Owner != nil {
+		ownerID = pp.Owner.ID
+	}
+
+	if _, err := r.ext().ExecContext(ctx, r.db.Rebind(queryInsertPaymentPlan),
+		pp.ID,
+		pp.Name,
+		toMinorUnits(pp.Cost, pp.Currency),
+		pp.Currency,
+		pp.Term,
+		ownerID,
+		pp.CreatedAt,
+		pp.UpdatedAt,
+		pp.DeletedAt,
+	); err != nil {
+		return errors.Wrap(wrapPQError(err), "error insert payment plan")
+	}
+	return nil
+}
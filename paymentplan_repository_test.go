@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestPaymentPlanRowOwner(t *testing.T) {
+	ownerID := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	for _, tc := range []struct {
+		name    string
+		ownerID *uuid.UUID
+		owned   bool
+	}{
+		{name: "null owner", ownerID: nil},
+		{name: "uuid_nil owner", ownerID: &NilUUID},
+		{name: "owner", ownerID: &ownerID, owned: true},
+	} {
+		row := paymentPlanRow{
+			ID:        MustParseUUID("00000000-0000-0000-0000-000000000002"),
+			Name:      "pro",
+			CostMinor: 1999,
+			Currency:  "USD",
+			Term:      string(TermMonthly),
+			OwnerID:   tc.ownerID,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		pp, err := row.toPaymentPlan()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tc.name, err)
+		}
+		if owned := pp.Owner != nil; owned != tc.owned {
+			t.Fatalf("%s: unexpected owner %v", tc.name, pp.Owner)
+		}
+		if pp.Cost != 19.99 || pp.DeletedAt != nil {
+			t.Fatalf("%s: unexpected plan %v", tc.name, pp)
+		}
+	}
+}
+
+func TestPaymentPlanRepositoryOwnerless(t *testing.T) {
+	db := openTestDB(t)
+	r := NewPaymentPlanRepository(db)
+	ctx := context.Background()
+
+	pp := &PaymentPlan{Name: "free", Cost: 0, Currency: "USD", Term: TermMonthly}
+	if err := r.Insert(ctx, pp); err != nil {
+		t.Fatalf("Error inserting payment plan: %s", err)
+	}
+	got, err := r.Get(ctx, pp.ID)
+	if err != nil {
+		t.Fatalf("Error reading back an ownerless payment plan: %s", err)
+	}
+	if got.Owner != nil {
+		t.Fatalf("Unexpected owner %v", got.Owner)
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	for _, tc := range []struct {
+		cost     float64
+		currency string
+		units    int64
+	}{
+		{19.99, "USD", 1999},
+		{0.1 + 0.2, "EUR", 30},
+		{1000, "JPY", 1000},
+		{1.234, "BHD", 1234},
+	} {
+		units := toMinorUnits(tc.cost, tc.currency)
+		if units != tc.units {
+			t.Fatalf("%v %s: expected %d minor units, got %d", tc.cost, tc.currency, tc.units, units)
+		}
+		if back := toMinorUnits(fromMinorUnits(units, tc.currency), tc.currency); back != units {
+			t.Fatalf("%v %s: round trip drifted to %d", tc.cost, tc.currency, back)
+		}
+	}
+	if cost := fromMinorUnits(1999, "USD"); cost != 19.99 {
+		t.Fatalf("Expected 19.99, got %v", cost)
+	}
+}
+
+func TestPaymentPlanRepositoryCost(t *testing.T) {
+	db := openTestDB(t)
+	r := NewPaymentPlanRepository(db)
+	ctx := context.Background()
+
+	for _, pp := range []*PaymentPlan{
+		{Name: "pro", Cost: 19.99, Currency: "USD", Term: TermMonthly},
+		{Name: "pro", Cost: 1000, Currency: "JPY", Term: TermYearly},
+	} {
+		if err := r.Insert(ctx, pp); err != nil {
+			t.Fatalf("Error inserting payment plan: %s", err)
+		}
+		got, err := r.Get(ctx, pp.ID)
+		if err != nil {
+			t.Fatalf("Error reading back payment plan: %s", err)
+		}
+		if got.Cost != pp.Cost || got.Currency != pp.Currency {
+			t.Fatalf("Expected %v %s, got %v %s", pp.Cost, pp.Currency, got.Cost, got.Currency)
+		}
+	}
+}
+
+func TestPaymentPlanRepositoryInsertCurrency(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewPaymentPlanRepository(sqlx.NewDb(nil, "postgres"), WithDryRun(&buf))
+
+	pp := &PaymentPlan{Name: "pro", Cost: 19.99, Currency: "usd", Term: TermMonthly}
+	if err := r.Insert(context.Background(), pp); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if pp.Currency != "USD" {
+		t.Fatalf("Expected the currency normalized to USD, got %q", pp.Currency)
+	}
+	if !strings.Contains(buf.String(), "= 'USD'") || !strings.Contains(buf.String(), "= 1999") {
+		t.Fatalf("Expected the normalized currency and minor units in:\n%s", buf.String())
+	}
+}
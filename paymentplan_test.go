@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerm(t *testing.T) {
+	for term, days := range map[Term]int{TermDaily: 1, TermWeekly: 7, TermMonthly: 30, TermYearly: 365} {
+		if !term.Valid() || term.Period() != time.Duration(days)*24*time.Hour {
+			t.Fatalf("%s: unexpected period %s", term, term.Period())
+		}
+	}
+	if Term("Monthy").Valid() || Term("Monthy").Period() != 0 {
+		t.Fatal("Expected a misspelled term to be invalid")
+	}
+}
+
+func TestPaymentPlanValidate(t *testing.T) {
+	if err := NewPaymentPlan("pro", 19.99, "USD", TermMonthly).Validate(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for field, pp := range map[string]*PaymentPlan{
+		"term": NewPaymentPlan("pro", 19.99, "USD", Term("Monthy")),
+		"cost": NewPaymentPlan("pro", -1, "USD", TermMonthly),
+	} {
+		err := pp.Validate()
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Fatalf("Expected an invalid %s, got %v", field, err)
+		}
+	}
+}
+
+func TestPaymentPlanValueRoundTrip(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	pp := PaymentPlan{
+		ID:       MustParseUUID("00000000-0000-0000-0000-000000000001"),
+		Name:     "pro, yearly",
+		Cost:     199.9,
+		Currency: "USD",
+		Term:     TermYearly,
+		Metadata: Metadata{
+			Owner:        &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000002")},
+			TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts},
+		},
+	}
+	v, err := pp.Value()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if s := v.(string); !strings.HasPrefix(s, `(00000000-0000-0000-0000-000000000001,"pro, yearly",199.9,USD,Yearly,`) {
+		t.Fatalf("Unexpected composite %s", s)
+	}
+
+	var got PaymentPlan
+	if err := got.Scan(v); err != nil {
+		t.Fatalf("Error scanning back %s: %s", v, err)
+	}
+	if !got.Equal(&pp) {
+		t.Fatalf("Round trip mismatch:\n%v\n%v", got, pp)
+	}
+
+	if literal, err := CompositeLiteral(pp); err != nil || !strings.Contains(literal, "199.9,USD,Yearly") {
+		t.Fatalf("Unexpected literal %s (%v)", literal, err)
+	}
+}
+
+func TestPaymentPlanScan(t *testing.T) {
+	var pp PaymentPlan
+	src := `(00000000-0000-0000-0000-000000000001,pro,19.99,usd,Monthly,00000000-0000-0000-0000-000000000002,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",,00000000-0000-0000-0000-000000000003)`
+	if err := pp.Scan([]byte(src)); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if pp.Name != "pro" || pp.Cost != 19.99 || pp.Currency != "USD" || pp.Term != TermMonthly {
+		t.Fatalf("Unexpected plan %v", pp)
+	}
+	if pp.Owner == nil || pp.Owner.ID.String() != "00000000-0000-0000-0000-000000000002" ||
+		pp.CreatedBy == nil || pp.CreatedBy.ID.String() != "00000000-0000-0000-0000-000000000003" || pp.IsDeleted() {
+		t.Fatalf("Unexpected plan metadata %+v", pp.Metadata)
+	}
+
+	// A NULL plan leaves the destination untouched.
+	null := PaymentPlan{Name: "untouched"}
+	if err := null.Scan(nil); err != nil {
+		t.Fatalf("Error scanning a NULL plan: %s", err)
+	}
+	if null.Name != "untouched" || null.ID != nil {
+		t.Fatalf("Unexpected plan after a NULL scan %v", null)
+	}
+
+	for _, src := range []string{
+		`(00000000-0000-0000-0000-000000000001,pro,19.99,USD,Monthly)`,
+		`(,pro,19.99,USD,Monthly,,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`,
+		`(00000000-0000-0000-0000-000000000001,pro,cheap,USD,Monthly,,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`,
+	} {
+		if err := new(PaymentPlan).Scan(src); err == nil {
+			t.Fatalf("Expected an error scanning %s", src)
+		}
+	}
+}
+
+func TestPaymentPlanScanSentinels(t *testing.T) {
+	const tmpl = `(00000000-0000-0000-0000-000000000001,pro,19.99,%s,%s,,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`
+	for _, tc := range []struct {
+		currency, term string
+		expect         error
+	}{
+		{"XXX", "Monthly", ErrInvalidCurrency},
+		{"USD", "Monthy", ErrInvalidTerm},
+	} {
+		err := new(PaymentPlan).Scan(fmt.Sprintf(tmpl, tc.currency, tc.term))
+		if !errors.Is(err, tc.expect) {
+			t.Fatalf("%s/%s: expected %v, got %v", tc.currency, tc.term, tc.expect, err)
+		}
+	}
+
+	if err := (&PaymentPlan{Name: "pro", Currency: "USD", Term: "Monthy"}).Validate(); !errors.Is(err, ErrInvalidTerm) {
+		t.Fatalf("Expected ErrInvalidTerm from Validate, got %v", err)
+	}
+}
+
+func TestPaymentPlanMarshalJSONGolden(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	pp := PaymentPlan{
+		ID:       MustParseUUID("00000000-0000-0000-0000-00000000000d"),
+		Name:     "pro",
+		Cost:     19.99,
+		Currency: "USD",
+		Term:     TermMonthly,
+		Metadata: Metadata{
+			Owner:        &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")},
+			TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts},
+		},
+	}
+	const expect = `{"cost":19.99,"created_at":"2020-01-02T03:04:05.000000Z","currency":"USD","name":"pro",` +
+		`"owner_id":"00000000-0000-0000-0000-000000000001","payment_plan_id":"00000000-0000-0000-0000-00000000000d",` +
+		`"term":"Monthly","updated_at":"2020-01-02T03:04:05.000000Z"}`
+
+	buf, err := json.Marshal(pp)
+	if err != nil {
+		t.Fatalf("Error marshaling payment plan: %s", err)
+	}
+	if string(buf) != expect {
+		t.Fatalf("Unexpected JSON:\n%s\nexpected:\n%s", buf, expect)
+	}
+
+	var got PaymentPlan
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatalf("Error unmarshaling %s: %s", buf, err)
+	}
+	if !got.Equal(&pp) {
+		t.Fatalf("Round trip mismatch:\n%v\n%v", got, pp)
+	}
+}
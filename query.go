@@ -0,0 +1,144 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// membershipComposite is the user_organization_join row in the field order expected by UserOrganization.Scan.
+const membershipComposite = "(uoj.user_id, uoj.organization_id, uoj.user_role, (uoj.owner_id, uoj.created_at, uoj.updated_at, uoj.deleted_at))"
+
+// teamMembershipComposite is the user_team_join row, along with the team organization, in the field order expected by UserTeam.Scan.
+const teamMembershipComposite = "(utj.user_id, t.organization_id, utj.user_role, (utj.owner_id, utj.created_at, utj.updated_at, utj.deleted_at), utj.team_id)"
+
+// membershipFilter drops the unmatched LEFT JOIN rows from the memberships aggregate:
+// their all-NULL fields would otherwise still build a non-NULL composite, i.e. `(,,,"(,,,)")`.
+// A user without membership then gets a NULL aggregate, scanned as no membership.
+const membershipFilter = " FILTER (WHERE uoj.user_id IS NOT NULL)"
+
+// teamComposite is the teams row in the field order expected by Team.Scan.
+const teamComposite = "(t.team_id, t.organization_id, t.name, t.capacity, t.owner_id, t.created_at, t.updated_at, t.deleted_at)"
+
+// userColumns maps the selected SQL expressions to the userRecord fields they are scanned into.
+// An ordered expression, if any, replaces expr when the query orders the memberships.
+var userColumns = []struct {
+	expr    string
+	ordered string
+	field   []string
+}{
+	{expr: "u.user_id", field: []string{"UserID"}},
+	{expr: "u.owner_id", field: []string{"OwnerID"}},
+	{
+		expr:    "array_agg(" + membershipComposite + ")" + membershipFilter,
+		ordered: "array_agg(" + membershipComposite + " ORDER BY uoj.organization_id)" + membershipFilter,
+		field:   []string{"Organizations"},
+	},
+	{expr: "u.created_at", field: []string{"CreatedAt"}},
+	{expr: "u.updated_at", field: []string{"UpdatedAt"}},
+	{expr: "u.deleted_at", field: []string{"DeletedAt"}},
+}
+
+// UserQuery builds the SELECT statement for User.
+// The column aliases are derived from the userRecord `db` tags so they always match what sqlx expects:
+// the query is meant to be scanned into a userRecord, the nullable owner_id included, and not into a User.
+type UserQuery struct {
+	Where   string // Optional filter, i.e. "u.user_id = ?".
+	OrderBy string // Optional ordering, i.e. "u.created_at, u.user_id".
+	Limit   int    // Optional maximum number of users, 0 means no limit.
+
+	// OrderMemberships orders the aggregated memberships of each user by organization_id,
+	// which array_agg does not guarantee otherwise. See UserOrganizations.Sort for the in-memory fallback.
+	OrderMemberships bool
+
+	// IncludeDeleted returns the soft-deleted users and memberships as well.
+	// By default, only the rows with a NULL deleted_at are returned.
+	IncludeDeleted bool
+}
+
+// String returns the SQL query, using `?` bindvars.
+func (q UserQuery) String() string {
+	userType := reflect.TypeOf(userRecord{})
+
+	cols := make([]string, 0, len(userColumns))
+	for _, col := range userColumns {
+		expr := col.expr
+		if q.OrderMemberships && col.ordered != "" {
+			expr = col.ordered
+		}
+		alias := dbPath(userType, col.field...)
+		if expr == "u."+alias {
+			cols = append(cols, "  "+expr)
+			continue
+		}
+		cols = append(cols, "  "+expr+` AS "`+alias+`"`)
+	}
+
+	query := "SELECT\n" + strings.Join(cols, ",\n") + `
+FROM users u
+LEFT JOIN user_organization_join uoj
+  ON uoj.user_id = u.user_id
+`
+	var where []string
+	if !q.IncludeDeleted {
+		query += "  AND uoj.deleted_at IS NULL\n"
+		where = append(where, "u.deleted_at IS NULL")
+	}
+	if q.Where != "" {
+		where = append(where, "("+q.Where+")")
+	}
+	if len(where) > 0 {
+		query += "WHERE " + strings.Join(where, " AND ") + "\n"
+	}
+	query += "GROUP BY u.user_id\n"
+	if q.OrderBy != "" {
+		query += "ORDER BY " + q.OrderBy + "\n"
+	}
+	if q.Limit > 0 {
+		query += "LIMIT " + strconv.Itoa(q.Limit) + "\n"
+	}
+	return query
+}
+
+// userPatchColumns returns the users columns a patch may set, keyed by column name.
+// They are the plain users columns of userColumns, which follow the userRecord `db` tags,
+// except the user_id primary key, the immutable created_at and updated_at which is bumped by every patch.
+func userPatchColumns() map[string]bool {
+	cols := map[string]bool{}
+	for _, col := range userColumns {
+		name := strings.TrimPrefix(col.expr, "u.")
+		if name == col.expr || name == "user_id" || name == "created_at" || name == "updated_at" {
+			continue
+		}
+		cols[name] = true
+	}
+	return cols
+}
+
+// BuildGetUserQuery returns the query fetching a single user and its organization memberships by user_id.
+func BuildGetUserQuery() string {
+	return UserQuery{Where: "u.user_id = ?"}.String()
+}
+
+// dbPath returns the sqlx column path of the given nested field, i.e. "metadata.owner.user_id".
+// It follows the `db` tags, defaulting to the lower-cased field name like sqlx does.
+// Panics if a field does not exist.
+func dbPath(t reflect.Type, fields ...string) string {
+	path := make([]string, 0, len(fields))
+	for _, name := range fields {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		f, ok := t.FieldByName(name)
+		if !ok {
+			panic("unknown field " + t.Name() + "." + name)
+		}
+		tag := strings.Split(f.Tag.Get("db"), ",")[0]
+		if tag == "" {
+			tag = strings.ToLower(f.Name)
+		}
+		path = append(path, tag)
+		t = f.Type
+	}
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUserQueryFiltersUnmatchedMemberships(t *testing.T) {
+	for _, q := range []UserQuery{{}, {OrderMemberships: true}} {
+		query := q.String()
+		if !strings.Contains(query, ") FILTER (WHERE uoj.user_id IS NOT NULL) AS") {
+			t.Fatalf("Missing memberships filter in:\n%s", query)
+		}
+	}
+}
+
+func TestUserOrganizationsScanNullAggregate(t *testing.T) {
+	var uos UserOrganizations
+	if err := uos.Scan(nil); err != nil {
+		t.Fatalf("Unexpected error scanning a NULL aggregate: %s", err)
+	}
+	if len(uos) != 0 {
+		t.Fatalf("Unexpected memberships: %v", uos)
+	}
+}
+
+func TestGetByIDWithoutMembership(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+
+	u := NewUser()
+	if err := r.Insert(ctx, u); err != nil {
+		t.Fatalf("Error inserting user: %s", err)
+	}
+	got, err := r.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Error reading back a user without membership: %s", err)
+	}
+	if len(got.Organizations) != 0 {
+		t.Fatalf("Unexpected memberships: %v", got.Organizations)
+	}
+}
+
+func TestUserQueryColumns(t *testing.T) {
+	query := UserQuery{}.String()
+	for _, col := range []string{"  u.user_id,\n", "  u.owner_id,\n", `AS "organization_memberships"`, "  u.created_at,\n", "  u.updated_at,\n", "  u.deleted_at\n"} {
+		if !strings.Contains(query, col) {
+			t.Fatalf("Missing column %q in:\n%s", col, query)
+		}
+	}
+}
+
+func TestDBPath(t *testing.T) {
+	for _, tc := range []struct {
+		typ    reflect.Type
+		fields []string
+		expect string
+	}{
+		{reflect.TypeOf(User{}), []string{"Metadata", "Owner", "ID"}, "metadata.owner.user_id"},
+		{reflect.TypeOf(&User{}), []string{"Metadata", "TimeMetadata", "CreatedAt"}, "metadata.timemetadata.created_at"},
+		{reflect.TypeOf(userRecord{}), []string{"Organizations"}, "organization_memberships"},
+	} {
+		if got := dbPath(tc.typ, tc.fields...); got != tc.expect {
+			t.Fatalf("%v: expected %s, got %s", tc.fields, tc.expect, got)
+		}
+	}
+
+	// userColumns must follow the userRecord fields, as BuildGetUserQuery relies on it.
+	for _, col := range userColumns {
+		dbPath(reflect.TypeOf(userRecord{}), col.field...)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for an unknown field")
+		}
+	}()
+	dbPath(reflect.TypeOf(User{}), "Nope")
+}
+
+func TestUserQueryIncludeDeleted(t *testing.T) {
+	filters := []string{"  AND uoj.deleted_at IS NULL\n", "WHERE u.deleted_at IS NULL AND (u.user_id = ?)\n"}
+
+	query := UserQuery{Where: "u.user_id = ?"}.String()
+	for _, filter := range filters {
+		if !strings.Contains(query, filter) {
+			t.Fatalf("Missing default filter %q in:\n%s", filter, query)
+		}
+	}
+
+	query = UserQuery{Where: "u.user_id = ?", IncludeDeleted: true}.String()
+	if strings.Contains(query, "deleted_at IS NULL") {
+		t.Fatalf("Unexpected deleted_at filter in:\n%s", query)
+	}
+	if !strings.Contains(query, "WHERE (u.user_id = ?)\n") {
+		t.Fatalf("Missing where clause in:\n%s", query)
+	}
+}
+
+func TestGetByIDDeletedMembership(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	o1, o2 := insertTestOrganization(t, db), insertTestOrganization(t, db)
+
+	now := Now()
+	u := NewUser()
+	u.Organizations = UserOrganizations{
+		{OrganizationID: o1.ID, Role: RoleMember, Metadata: testOwnerMetadata()},
+		{OrganizationID: o2.ID, Role: RoleMember, Metadata: testOwnerMetadata()},
+	}
+	u.Organizations[1].Metadata.DeletedAt = &now
+	if err := NewUserRepository(db).InsertWithMemberships(ctx, u); err != nil {
+		t.Fatalf("Error inserting user: %s", err)
+	}
+
+	for _, tc := range []struct {
+		opts   []RepositoryOption
+		expect int
+	}{
+		{expect: 1},
+		{opts: []RepositoryOption{WithDeleted()}, expect: 2},
+	} {
+		got, err := NewUserRepository(db, tc.opts...).GetByID(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("Error getting user: %s", err)
+		}
+		if len(got.Organizations) != tc.expect {
+			t.Fatalf("Expected %d memberships, got %v", tc.expect, got.Organizations)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/creack/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// UserStore is the User persistence, implemented by UserRepository and MemoryUserStore.
+type UserStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
+	Insert(ctx context.Context, u *User) error
+	SoftDelete(ctx context.Context, id uuid.UUID) error
+	ListUsers(ctx context.Context, cursor Cursor, limit int) ([]*User, Cursor, error)
+}
+
+// UserRepository handles the User persistence.
+type UserRepository struct {
+	repository
+}
+
+// userRecord is the users row along with its aggregated memberships, as selected by UserQuery.
+// The users columns are scanned into a flat UserRow rather than into a User:
+// User implements sql.Scanner, so sqlx would scan the whole row into it,
+// and a NULL owner_id cannot be scanned into the Owner uuid.UUID.
+type userRecord struct {
+	UserRow
+	Organizations UserOrganizations `db:"organization_memberships"`
+}
+
+// toUser returns the User of the record.
+func (r *userRecord) toUser() *User {
+	u := r.UserRow.ToUser()
+	u.Organizations = r.Organizations
+	return u
+}
+
+// NewUserRepository instantiates a new UserRepository on top of the given db.
+func NewUserRepository(db *sqlx.DB, opts ...RepositoryOption) *UserRepository {
+	return &UserRepository{repository: newRepository(db, opts...)}
+}
+
+// GetByID fetches the user with the given id along with its organization memberships.
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	q := UserQuery{Where: "u.user_id = ?", IncludeDeleted: r.includeDeleted}
+	u := &userRecord{}
+	if err := r.db.GetContext(ctx, u, r.db.Rebind(q.String()), id); err != nil {
+		return nil, errors.Wrapf(err, "error get user %s", id)
+	}
+	return u.toUser(), nil
+}
+
+// Insert creates the given user.
+// A random user_id is assigned when missing and the timestamps are touched.
+// The memberships are not inserted, see InsertWithMemberships.
+func (r *UserRepository) Insert(ctx context.Context, u *User) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	return insertUser(ctx, r.ext(), u)
+}
+
+// InsertWithMemberships creates the given user along with its organization memberships, atomically.
+// The memberships missing a user_id are assigned the user one.
+// Nothing is written if any insert fails.
+func (r *UserRepository) InsertWithMemberships(ctx context.Context, u *User) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	if r.dryRun != nil {
+		return insertUserWithMemberships(ctx, r.ext(), u)
+	}
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "error begin transaction")
+	}
+	if err := insertUserWithMemberships(ctx, tx, u); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(wrapPQError(err), "error commit transaction")
+	}
+	return nil
+}
+
+// insertUserWithMemberships creates the given user and then its memberships with the given db or transaction.
+func insertUserWithMemberships(ctx context.Context, db sqlx.ExtContext, u *User) error {
+	if err := insertUser(ctx, db, u); err != nil {
+		return err
+	}
+	for i := range u.Organizations {
+		if u.Organizations[i].UserID == nil {
+			u.Organizations[i].UserID = u.ID
+		}
+	}
+	return insertMemberships(ctx, db, u.Organizations)
+}
+
+// insertUser creates the given user with the given db or transaction.
+func insertUser(ctx context.Context, db sqlx.ExtContext, u *User) error {
+	const queryInsertUser = `
+INSERT INTO users (
+  user_id,
+  owner_id,
+  created_at,
+  updated_at,
+  deleted_at
+) VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
+`
+	if u.ID == nil {
+		u.ID = newUUID()
+	}
+	u.Metadata.Touch()
+
+	// Ownerless users are stored with a NULL owner_id.
+	var ownerID interface{}
+	if id, ok := u.OwnerID(); ok {
+		ownerID = id
+	}
+
+	query := db.Rebind(queryInsertUser)
+	if _, err := db.ExecContext(ctx, query,
+		u.ID,
+		ownerID,
+		u.Metadata.CreatedAt,
+		u.Metadata.UpdatedAt,
+		u.Metadata.DeletedAt,
+	); err != nil {
+		return errors.Wrap(wrapPQError(err), "error insert user")
+	}
+	return nil
+}
+
+// Upsert creates the given user or, if its user_id already exists, updates its owner.
+// On conflict, created_at is preserved and updated_at bumped; both are read back into u.
+// A random user_id is assigned when missing.
+// With WithDryRun, nothing is read back and u keeps its touched timestamps.
+func (r *UserRepository) Upsert(ctx context.Context, u *User) error {
+	const queryUpsertUser = `
+INSERT INTO users (
+  user_id,
+  owner_id,
+  created_at,
+  updated_at,
+  deleted_at
+) VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
+ON CONFLICT (user_id) DO UPDATE
+SET
+  owner_id = EXCLUDED.owner_id,
+  updated_at = NOW()
+RETURNING created_at, updated_at
+`
+	if u.ID == nil {
+		u.ID = newUUID()
+	}
+	u.Metadata.Touch()
+
+	// Ownerless users are stored with a NULL owner_id.
+	var ownerID interface{}
+	if id, ok := u.OwnerID(); ok {
+		ownerID = id
+	}
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	args := []interface{}{
+		u.ID,
+		ownerID,
+		u.Metadata.CreatedAt,
+		u.Metadata.UpdatedAt,
+		u.Metadata.DeletedAt,
+	}
+	if r.dryRun != nil {
+		return printQuery(r.dryRun, r.db.Rebind(queryUpsertUser), args...)
+	}
+	if err := r.db.QueryRowxContext(ctx, r.db.Rebind(queryUpsertUser), args...).Scan(&u.Metadata.CreatedAt, &u.Metadata.UpdatedAt); err != nil {
+		return errors.Wrapf(wrapPQError(err), "error upsert user %s", u.ID)
+	}
+	return nil
+}
+
+// SoftDelete marks the user with the given id as deleted.
+// Deleting an already deleted user is a no-op.
+func (r *UserRepository) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	const querySoftDeleteUser = `
+UPDATE users
+SET
+  deleted_at = NOW(),
+  updated_at = NOW()
+WHERE user_id = ?
+  AND deleted_at IS NULL
+`
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	if _, err := r.ext().ExecContext(ctx, r.db.Rebind(querySoftDeleteUser), id); err != nil {
+		return errors.Wrapf(wrapPQError(err), "error soft delete user %s", id)
+	}
+	return nil
+}
+
+// Patch updates only the given columns of the user with the given id, leaving the others untouched,
+// and bumps its updated_at. The changes are keyed by users column name, i.e. "owner_id" or "deleted_at".
+// Unknown or read-only columns are rejected before issuing the query.
+// Returns sql.ErrNoRows, wrapped, if there is no such user. With WithDryRun, the existence is not checked.
+func (r *UserRepository) Patch(ctx context.Context, id uuid.UUID, changes map[string]interface{}) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	allowed := userPatchColumns()
+	cols := make([]string, 0, len(changes))
+	for col := range changes {
+		if !allowed[col] {
+			return errors.Errorf("invalid column %q for user patch", col)
+		}
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	args := make(map[string]interface{}, len(changes)+1)
+	sets := make([]string, 0, len(cols)+1)
+	for _, col := range cols {
+		sets = append(sets, "  "+col+" = :"+col)
+		args[col] = changes[col]
+	}
+	sets = append(sets, "  updated_at = NOW()")
+	args["user_id"] = id
+
+	query, bindArgs, err := sqlx.Named("UPDATE users\nSET\n"+strings.Join(sets, ",\n")+"\nWHERE user_id = :user_id\n", args)
+	if err != nil {
+		return errors.Wrapf(err, "error bind user patch %s", id)
+	}
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	res, err := r.ext().ExecContext(ctx, r.db.Rebind(query), bindArgs...)
+	if err != nil {
+		return errors.Wrapf(wrapPQError(err), "error patch user %s", id)
+	}
+	if r.dryRun != nil {
+		return nil
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "error patch user %s", id)
+	}
+	if n == 0 {
+		return errors.Wrapf(sql.ErrNoRows, "error patch user %s", id)
+	}
+	return nil
+}
+
+// InsertMemberships creates the given organization memberships using a single multi-row INSERT.
+// All the memberships are validated before issuing the query.
+// Inputs exceeding the postgres bindvar limit are split in several statements.
+func (r *UserRepository) InsertMemberships(ctx context.Context, uos []UserOrganization) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	return insertMemberships(ctx, r.ext(), uos)
+}
+
+// insertMemberships creates the given organization memberships with the given db or transaction.
+func insertMemberships(ctx context.Context, db sqlx.ExtContext, uos []UserOrganization) error {
+	const (
+		queryInsertMemberships = `
+INSERT INTO user_organization_join (
+  user_id,
+  organization_id,
+  user_role,
+  owner_id,
+  created_at,
+  updated_at,
+  deleted_at
+) VALUES
+`
+		valuesPlaceholder = "(?, ?, ?, ?, ?, ?, ?)"
+		columnCount       = 7
+		maxBindvars       = 65535
+	)
+
+	for i := range uos {
+		if err := uos[i].Validate(); err != nil {
+			return errors.Wrapf(err, "invalid membership %d", i)
+		}
+	}
+
+	for len(uos) > 0 {
+		batch := uos
+		if len(batch) > maxBindvars/columnCount {
+			batch = batch[:maxBindvars/columnCount]
+		}
+		uos = uos[len(batch):]
+
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*columnCount)
+		for i := range batch {
+			uo := &batch[i]
+			uo.Metadata.Touch()
+
+			var ownerID interface{}
+			if uo.Metadata.Owner != nil {
+				ownerID = uo.Metadata.Owner.ID
+			}
+			placeholders[i] = valuesPlaceholder
+			args = append(args,
+				uo.UserID,
+				uo.OrganizationID,
+				uo.Role,
+				ownerID,
+				uo.Metadata.CreatedAt,
+				uo.Metadata.UpdatedAt,
+				uo.Metadata.DeletedAt,
+			)
+		}
+
+		query := db.Rebind(queryInsertMemberships + strings.Join(placeholders, ",\n"))
+		if _, err := db.ExecContext(ctx, query, args...); err != nil {
+			return errors.Wrap(wrapPQError(err), "error insert memberships")
+		}
+	}
+	return nil
+}
+
+// LoadTeams fetches the team memberships of the given user, across all organizations, into u.Teams.
+// A user without team gets an empty slice.
+func (r *UserRepository) LoadTeams(ctx context.Context, u *User) error {
+	query := `
+SELECT ` + teamMembershipComposite + `
+FROM user_team_join utj
+JOIN teams t
+  ON t.team_id = utj.team_id
+WHERE utj.user_id = ?
+`
+	if !r.includeDeleted {
+		query += "  AND utj.deleted_at IS NULL\n  AND t.deleted_at IS NULL\n"
+	}
+	query += "ORDER BY t.organization_id, t.name\n"
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	teams := []UserTeam{}
+	if err := r.db.SelectContext(ctx, &teams, r.db.Rebind(query), u.ID); err != nil {
+		return errors.Wrapf(err, "error load teams of user %s", u.ID)
+	}
+	u.Teams = teams
+	return nil
+}
+
+// GetUsersByIDs fetches the users with the given ids along with their organization memberships, in a single query.
+// The users are keyed by their id string; ids not found are missing from the map.
+func (r *UserRepository) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) (map[string]*User, error) {
+	strIDs := make([]string, 0, len(ids))
+	seen := map[string]bool{}
+	for _, id := range ids {
+		s := id.String()
+		if !seen[s] {
+			seen[s] = true
+			strIDs = append(strIDs, s)
+		}
+	}
+	users := map[string]*User{}
+	if len(strIDs) == 0 {
+		return users, nil
+	}
+
+	list, err := r.selectUsers(ctx, UserQuery{Where: "u.user_id = ANY(?)"}, pq.Array(strIDs))
+	if err != nil {
+		return nil, errors.Wrap(err, "error get users by ids")
+	}
+	for _, u := range list {
+		users[u.ID.String()] = u
+	}
+	return users, nil
+}
+
+// FindAdmins returns the users who are admin of any of the given organizations,
+// each once, along with all their organization memberships.
+// A soft-deleted admin membership only counts with WithDeleted.
+func (r *UserRepository) FindAdmins(ctx context.Context, orgIDs []uuid.UUID) ([]*User, error) {
+	if len(orgIDs) == 0 {
+		return []*User{}, nil
+	}
+	strIDs := make([]string, len(orgIDs))
+	for i, id := range orgIDs {
+		strIDs[i] = id.String()
+	}
+
+	admins := `
+  SELECT user_id
+  FROM user_organization_join
+  WHERE organization_id = ANY(?)
+    AND user_role = ?
+`
+	if !r.includeDeleted {
+		admins += "    AND deleted_at IS NULL\n"
+	}
+	q := UserQuery{
+		Where:   "u.user_id IN (" + admins + ")",
+		OrderBy: "u.created_at, u.user_id",
+	}
+	users, err := r.selectUsers(ctx, q, pq.Array(strIDs), RoleAdmin)
+	if err != nil {
+		return nil, errors.Wrap(err, "error find admins")
+	}
+	return users, nil
+}
+
+// ListByOwner returns the users owned by the given owner, with their memberships, ordered by creation.
+// A nil or `uuid_nil()` owner id is invalid.
+func (r *UserRepository) ListByOwner(ctx context.Context, ownerID uuid.UUID) ([]*User, error) {
+	if IsNil(ownerID) {
+		return nil, errors.New("invalid owner_id for list by owner")
+	}
+	q := UserQuery{
+		Where:   "u.owner_id = ?",
+		OrderBy: "u.created_at, u.user_id",
+	}
+	users, err := r.selectUsers(ctx, q, ownerID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error list users of owner %s", ownerID)
+	}
+	return users, nil
+}
+
+// ResolveOwners replaces the stub owners of the given metadata, which only carry an id after scanning,
+// with the full owner users, loaded in a single query.
+// Nil metadata and nil owners are skipped; owners not found are left as is.
+func (r *UserRepository) ResolveOwners(ctx context.Context, ms ...*Metadata) error {
+	ids := []uuid.UUID{}
+	for _, m := range ms {
+		if m != nil && m.Owner != nil && m.Owner.ID != nil {
+			ids = append(ids, m.Owner.ID)
+		}
+	}
+	byID, err := r.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return errors.Wrap(err, "error resolve owners")
+	}
+	for _, m := range ms {
+		if m == nil || m.Owner == nil || m.Owner.ID == nil {
+			continue
+		}
+		if owner, ok := byID[m.Owner.ID.String()]; ok {
+			m.Owner = owner
+		}
+	}
+	return nil
+}
+
+// selectUsers runs the given query and returns the matching users.
+// The soft-deleted users are included if either the query or the repository asks for them.
+func (r *UserRepository) selectUsers(ctx context.Context, q UserQuery, args ...interface{}) ([]*User, error) {
+	q.IncludeDeleted = q.IncludeDeleted || r.includeDeleted
+
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+
+	records := []*userRecord{}
+	if err := r.db.SelectContext(ctx, &records, r.db.Rebind(q.String()), args...); err != nil {
+		return nil, errors.Wrap(err, "error select users")
+	}
+	users := make([]*User, len(records))
+	for i, u := range records {
+		users[i] = u.toUser()
+	}
+	return users, nil
+}
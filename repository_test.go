@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/creack/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestUserRepositoryCRUD(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+
+	u := &User{}
+	if err := r.Insert(ctx, u); err != nil {
+		t.Fatalf("Error inserting user: %s", err)
+	}
+	if u.ID == nil || u.Metadata.CreatedAt.IsZero() {
+		t.Fatalf("Expected the insert to assign an id and timestamps, got %v", u)
+	}
+
+	got, err := r.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Error reading back the user: %s", err)
+	}
+	// The database keeps microseconds: compare the canonical timestamps.
+	if !uuid.Equal(got.ID, u.ID) || got.Metadata.CreatedAt.String() != u.Metadata.CreatedAt.String() || got.Metadata.IsDeleted() {
+		t.Fatalf("Expected %v, got %v", u, got)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := r.SoftDelete(ctx, u.ID); err != nil {
+			t.Fatalf("Error soft deleting the user: %s", err)
+		}
+	}
+	if _, err := r.GetByID(ctx, u.ID); errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("Expected a soft-deleted user to be filtered out, got %v", err)
+	}
+	got, err = NewUserRepository(db, WithDeleted()).GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Error reading back the deleted user: %s", err)
+	}
+	if !got.Metadata.IsDeleted() {
+		t.Fatalf("Expected a deleted_at, got %v", got.Metadata)
+	}
+}
+
+func TestGetByIDOwnerless(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+
+	owner := NewUser()
+	owned := NewUser()
+	owned.Metadata.Owner = owner
+	for _, u := range []*User{owner, owned} {
+		if err := r.Insert(ctx, u); err != nil {
+			t.Fatalf("Error inserting user: %s", err)
+		}
+	}
+
+	got, err := r.GetByID(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("Error reading back an ownerless user: %s", err)
+	}
+	if got.Metadata.Owner != nil {
+		t.Fatalf("Unexpected owner %v", got.Metadata.Owner)
+	}
+	got, err = r.GetByID(ctx, owned.ID)
+	if err != nil {
+		t.Fatalf("Error reading back an owned user: %s", err)
+	}
+	if got.Metadata.Owner == nil || !uuid.Equal(got.Metadata.Owner.ID, owner.ID) {
+		t.Fatalf("Unexpected owner %v", got.Metadata.Owner)
+	}
+}
+
+func TestInsertOwnerlessUser(t *testing.T) {
+	u := &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000001")}
+	if _, ok := u.OwnerID(); ok {
+		t.Fatal("Expected no owner id for an ownerless user")
+	}
+	u.Metadata.Owner = &User{ID: MustParseUUID("00000000-0000-0000-0000-000000000002")}
+	if id, ok := u.OwnerID(); !ok || !uuid.Equal(id, u.Metadata.Owner.ID) {
+		t.Fatalf("Expected the owner id, got %v, %t", id, ok)
+	}
+	u.Metadata.Owner = nil
+
+	var buf bytes.Buffer
+	r := NewUserRepository(sqlx.NewDb(nil, "postgres"), WithDryRun(&buf))
+	if err := r.Insert(context.Background(), u); err != nil {
+		t.Fatalf("Unexpected error inserting an ownerless user: %s", err)
+	}
+	if !strings.Contains(buf.String(), "-- $2 = NULL") {
+		t.Fatalf("Expected a NULL owner_id in:\n%s", buf.String())
+	}
+}
+
+func TestInsertMembershipsDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewUserRepository(sqlx.NewDb(nil, "postgres"), WithDryRun(&buf))
+	ctx := context.Background()
+	orgID := MustParseUUID("00000000-0000-0000-0000-00000000000b")
+
+	// One more membership than a statement holds: 65535 bindvars of 7 columns.
+	uos := make([]UserOrganization, 65535/7+1)
+	for i := range uos {
+		uos[i] = UserOrganization{UserID: newUUID(), OrganizationID: orgID, Role: RoleMember}
+	}
+	if err := r.InsertMemberships(ctx, uos); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if n := strings.Count(buf.String(), "INSERT INTO user_organization_join"); n != 2 {
+		t.Fatalf("Expected the memberships split in 2 statements, got %d", n)
+	}
+
+	buf.Reset()
+	invalid := []UserOrganization{uos[0], {UserID: newUUID(), OrganizationID: orgID, Role: Role("root")}}
+	if err := r.InsertMemberships(ctx, invalid); err == nil {
+		t.Fatal("Expected an error for an invalid role")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no statement for an invalid input, got:\n%s", buf.String())
+	}
+}
+
+// benchmarkMemberships seeds an organization and n users, and returns their memberships.
+func benchmarkMemberships(b *testing.B, db *sqlx.DB, n int) []UserOrganization {
+	b.Helper()
+
+	r := NewUserRepository(db)
+	o := insertTestOrganization(b, db)
+	uos := make([]UserOrganization, n)
+	for i := range uos {
+		u := NewUser()
+		if err := r.Insert(context.Background(), u); err != nil {
+			b.Fatalf("Error inserting user: %s", err)
+		}
+		uos[i] = UserOrganization{UserID: u.ID, OrganizationID: o.ID, Role: RoleMember, Metadata: testOwnerMetadata()}
+	}
+	return uos
+}
+
+func BenchmarkInsertMemberships(b *testing.B) {
+	db := openTestDB(b)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+	uos := benchmarkMemberships(b, db, 1000)
+
+	b.Run("single statement", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			db.MustExec("DELETE FROM user_organization_join")
+			b.StartTimer()
+			if err := r.InsertMemberships(ctx, uos); err != nil {
+				b.Fatalf("Error inserting memberships: %s", err)
+			}
+		}
+	})
+	b.Run("loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			db.MustExec("DELETE FROM user_organization_join")
+			b.StartTimer()
+			for j := range uos {
+				if err := r.InsertMemberships(ctx, uos[j:j+1]); err != nil {
+					b.Fatalf("Error inserting membership: %s", err)
+				}
+			}
+		}
+	})
+}
+
+func TestResolveOwners(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+
+	owner := NewUser()
+	if err := r.Insert(ctx, owner); err != nil {
+		t.Fatalf("Error inserting owner: %s", err)
+	}
+	missing := &User{ID: uuid.NewRandom()}
+
+	ms := []*Metadata{
+		{Owner: &User{ID: owner.ID}},
+		{Owner: &User{ID: owner.ID}},
+		{Owner: missing},
+		{},
+		nil,
+	}
+	if err := r.ResolveOwners(ctx, ms...); err != nil {
+		t.Fatalf("Error resolving owners: %s", err)
+	}
+	if ms[0].Owner.Metadata.CreatedAt.IsZero() {
+		t.Fatalf("Expected a loaded owner, got %v", ms[0].Owner)
+	}
+	// The owners are loaded once: the metadata sharing an owner share the same user.
+	if ms[0].Owner != ms[1].Owner {
+		t.Fatal("Expected the same owner to be loaded once")
+	}
+	if ms[2].Owner != missing || ms[3].Owner != nil {
+		t.Fatalf("Unexpected unresolved owners %v, %v", ms[2].Owner, ms[3].Owner)
+	}
+}
+
+func TestResolveOwnersWithoutOwners(t *testing.T) {
+	// Without any owner to load, no query is issued: the nil db would panic otherwise.
+	r := NewUserRepository(sqlx.NewDb(nil, "postgres"))
+	if err := r.ResolveOwners(context.Background(), &Metadata{}, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	users, err := r.GetUsersByIDs(context.Background(), nil)
+	if err != nil || users == nil || len(users) != 0 {
+		t.Fatalf("Expected an empty map, got %v (%v)", users, err)
+	}
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+	o1, o2 := insertTestOrganization(t, db), insertTestOrganization(t, db)
+
+	u1, u2 := NewUser(), NewUser()
+	u1.Organizations = UserOrganizations{
+		{OrganizationID: o1.ID, Role: RoleAdmin, Metadata: testOwnerMetadata()},
+		{OrganizationID: o2.ID, Role: RoleMember, Metadata: testOwnerMetadata()},
+	}
+	u2.Organizations = UserOrganizations{{OrganizationID: o2.ID, Role: RoleMember, Metadata: testOwnerMetadata()}}
+	for _, u := range []*User{u1, u2} {
+		if err := r.InsertWithMemberships(ctx, u); err != nil {
+			t.Fatalf("Error inserting user: %s", err)
+		}
+	}
+
+	users, err := r.GetUsersByIDs(ctx, []uuid.UUID{u1.ID, u2.ID, u1.ID, uuid.NewRandom()})
+	if err != nil {
+		t.Fatalf("Error getting users: %s", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("Expected 2 users, got %d", len(users))
+	}
+	if got := users[u1.ID.String()]; got == nil || len(got.Organizations) != 2 {
+		t.Fatalf("Unexpected user %v", got)
+	}
+	if got := users[u2.ID.String()]; got == nil || len(got.Organizations) != 1 {
+		t.Fatalf("Unexpected user %v", got)
+	}
+}
+
+func BenchmarkGetUsersByIDs(b *testing.B) {
+	db := openTestDB(b)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+	uos := benchmarkMemberships(b, db, 100)
+	if err := r.InsertMemberships(ctx, uos); err != nil {
+		b.Fatalf("Error inserting memberships: %s", err)
+	}
+	ids := make([]uuid.UUID, len(uos))
+	for i, uo := range uos {
+		ids[i] = uo.UserID
+	}
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := r.GetUsersByIDs(ctx, ids); err != nil {
+				b.Fatalf("Error getting users: %s", err)
+			}
+		}
+	})
+	b.Run("loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, id := range ids {
+				if _, err := r.GetByID(ctx, id); err != nil {
+					b.Fatalf("Error getting user: %s", err)
+				}
+			}
+		}
+	})
+}
+
+func TestInsertWithMembershipsRollback(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+	o := insertTestOrganization(t, db)
+
+	for _, tc := range []struct {
+		uos    UserOrganizations
+		expect error
+	}{
+		{uos: UserOrganizations{{OrganizationID: o.ID, Role: Role("superuser"), Metadata: testOwnerMetadata()}}, expect: ErrInvalidRole},
+		{uos: UserOrganizations{ // Duplicate primary key.
+			{OrganizationID: o.ID, Role: RoleMember, Metadata: testOwnerMetadata()},
+			{OrganizationID: o.ID, Role: RoleAdmin, Metadata: testOwnerMetadata()},
+		}, expect: ErrDuplicate},
+	} {
+		u := NewUser()
+		u.Organizations = tc.uos
+		err := r.InsertWithMemberships(ctx, u)
+		if !errors.Is(err, tc.expect) {
+			t.Fatalf("Expected %s inserting the memberships %v, got %v", tc.expect, tc.uos, err)
+		}
+		if _, err := NewUserRepository(db, WithDeleted()).GetByID(ctx, u.ID); errors.Cause(err) != sql.ErrNoRows {
+			t.Fatalf("Expected the user insert to be rolled back, got %v", err)
+		}
+	}
+}
+
+func TestPatchColumns(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewUserRepository(sqlx.NewDb(nil, "postgres"), WithDryRun(&buf))
+	id := MustParseUUID("00000000-0000-0000-0000-000000000001")
+
+	for _, col := range []string{"user_id", "created_at", "updated_at", "organization_memberships", "nope"} {
+		if err := r.Patch(context.Background(), id, map[string]interface{}{col: nil}); err == nil {
+			t.Fatalf("Expected %s to be rejected", col)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Unexpected query for a rejected patch:\n%s", buf.String())
+	}
+
+	// The patch columns must be the userRecord columns they are scanned back into.
+	for _, col := range userColumns {
+		if name := strings.TrimPrefix(col.expr, "u."); userPatchColumns()[name] {
+			if alias := dbPath(reflect.TypeOf(userRecord{}), col.field...); alias != name {
+				t.Fatalf("Patch column %s is scanned into %s", name, alias)
+			}
+		}
+	}
+
+	// The dry run reports no affected row, which must not be taken for a missing user.
+	if err := r.Patch(context.Background(), id, map[string]interface{}{"owner_id": nil, "deleted_at": nil}); err != nil {
+		t.Fatalf("Unexpected dry run error: %s", err)
+	}
+	if !strings.Contains(buf.String(), "deleted_at = $1,\n  owner_id = $2,\n  updated_at = NOW()") {
+		t.Fatalf("Unexpected patch query:\n%s", buf.String())
+	}
+}
+
+func TestPatchMissingUser(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+
+	err := r.Patch(context.Background(), newUUID(), map[string]interface{}{"deleted_at": nil})
+	if errors.Cause(err) != sql.ErrNoRows {
+		t.Fatalf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestFindAdminsDeletedMembership(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	o := insertTestOrganization(t, db)
+
+	u := NewUser()
+	now := Now()
+	u.Organizations = UserOrganizations{{
+		OrganizationID: o.ID,
+		Role:           RoleAdmin,
+		Metadata:       testOwnerMetadata(),
+	}}
+	u.Organizations[0].Metadata.DeletedAt = &now
+	if err := NewUserRepository(db).InsertWithMemberships(ctx, u); err != nil {
+		t.Fatalf("Error inserting user: %s", err)
+	}
+
+	for _, tc := range []struct {
+		opts   []RepositoryOption
+		expect int
+	}{
+		{expect: 0},
+		{opts: []RepositoryOption{WithDeleted()}, expect: 1},
+	} {
+		admins, err := NewUserRepository(db, tc.opts...).FindAdmins(ctx, []uuid.UUID{o.ID})
+		if err != nil {
+			t.Fatalf("Error finding admins: %s", err)
+		}
+		if len(admins) != tc.expect {
+			t.Fatalf("Expected %d admins, got %d", tc.expect, len(admins))
+		}
+	}
+}
+
+func TestLoadTeams(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	orgs := NewOrganizationRepository(db)
+	ctx := context.Background()
+
+	u, lonely := NewUser(), NewUser()
+	for _, user := range []*User{u, lonely} {
+		if err := r.Insert(ctx, user); err != nil {
+			t.Fatalf("Error inserting user: %s", err)
+		}
+	}
+	teams := map[string]bool{}
+	for _, o := range []*Organization{insertTestOrganization(t, db), insertTestOrganization(t, db)} {
+		team := &Team{Name: "devs"}
+		if err := orgs.AddTeam(ctx, o.ID, team); err != nil {
+			t.Fatalf("Error adding team: %s", err)
+		}
+		db.MustExec(db.Rebind(`INSERT INTO user_team_join (team_id, user_id, user_role) VALUES (?, ?, ?)`), team.ID, u.ID, RoleAdmin)
+		teams[team.ID.String()] = true
+	}
+
+	if err := r.LoadTeams(ctx, u); err != nil {
+		t.Fatalf("Error loading teams: %s", err)
+	}
+	if len(u.Teams) != 2 {
+		t.Fatalf("Expected 2 teams, got %v", u.Teams)
+	}
+	for _, ut := range u.Teams {
+		if !teams[ut.TeamID.String()] || !uuid.Equal(ut.UserID, u.ID) || ut.Role != RoleAdmin {
+			t.Fatalf("Unexpected team membership %v", ut)
+		}
+	}
+
+	if err := r.LoadTeams(ctx, lonely); err != nil {
+		t.Fatalf("Error loading teams: %s", err)
+	}
+	if lonely.Teams == nil || len(lonely.Teams) != 0 {
+		t.Fatalf("Expected an empty slice, got %#v", lonely.Teams)
+	}
+}
+
+func TestUpsertDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewUserRepository(sqlx.NewDb(nil, "postgres"), WithDryRun(&buf))
+
+	u := &User{}
+	if err := r.Upsert(context.Background(), u); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if u.ID == nil || u.Metadata.CreatedAt.IsZero() {
+		t.Fatalf("Expected an id and touched timestamps, got %v", u)
+	}
+	for _, clause := range []string{"ON CONFLICT (user_id) DO UPDATE", "owner_id = EXCLUDED.owner_id", "updated_at = NOW()"} {
+		if !strings.Contains(buf.String(), clause) {
+			t.Fatalf("Missing %q in:\n%s", clause, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "created_at = ") {
+		t.Fatalf("Unexpected created_at update in:\n%s", buf.String())
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+
+	owner := NewUser()
+	if err := r.Insert(ctx, owner); err != nil {
+		t.Fatalf("Error inserting owner: %s", err)
+	}
+
+	u := NewUser()
+	if err := r.Upsert(ctx, u); err != nil {
+		t.Fatalf("Error upserting a new user: %s", err)
+	}
+	createdAt, updatedAt := u.Metadata.CreatedAt, u.Metadata.UpdatedAt
+
+	conflict := &User{ID: u.ID, Metadata: Metadata{Owner: &User{ID: owner.ID}}}
+	if err := r.Upsert(ctx, conflict); err != nil {
+		t.Fatalf("Error upserting an existing user: %s", err)
+	}
+	if !conflict.Metadata.CreatedAt.Equal(createdAt) {
+		t.Fatalf("Expected created_at %s to be preserved, got %s", createdAt, conflict.Metadata.CreatedAt)
+	}
+	if !conflict.Metadata.UpdatedAt.After(updatedAt) {
+		t.Fatalf("Expected updated_at to be bumped after %s, got %s", updatedAt, conflict.Metadata.UpdatedAt)
+	}
+
+	got, err := r.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Error reading back the user: %s", err)
+	}
+	if got.Metadata.Owner == nil || !uuid.Equal(got.Metadata.Owner.ID, owner.ID) {
+		t.Fatalf("Expected the owner to be updated, got %v", got.Metadata.Owner)
+	}
+}
+
+func TestListByOwner(t *testing.T) {
+	db := openTestDB(t)
+	r := NewUserRepository(db)
+	ctx := context.Background()
+
+	owner := NewUser()
+	if err := r.Insert(ctx, owner); err != nil {
+		t.Fatalf("Error inserting owner: %s", err)
+	}
+	owned := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		u := NewUser()
+		u.Metadata.Owner = &User{ID: owner.ID}
+		if err := r.Insert(ctx, u); err != nil {
+			t.Fatalf("Error inserting user: %s", err)
+		}
+		owned[u.ID.String()] = true
+		if i == 2 {
+			if err := r.SoftDelete(ctx, u.ID); err != nil {
+				t.Fatalf("Error soft deleting user: %s", err)
+			}
+			delete(owned, u.ID.String())
+		}
+	}
+	if err := r.Insert(ctx, NewUser()); err != nil {
+		t.Fatalf("Error inserting an unowned user: %s", err)
+	}
+
+	users, err := r.ListByOwner(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("Error listing users: %s", err)
+	}
+	if len(users) != len(owned) {
+		t.Fatalf("Expected %d users, got %d", len(owned), len(users))
+	}
+	for _, u := range users {
+		if !owned[u.ID.String()] {
+			t.Fatalf("Unexpected user %s", u.ID)
+		}
+	}
+}
+
+func TestListByOwnerNil(t *testing.T) {
+	r := NewUserRepository(sqlx.NewDb(nil, "postgres"))
+	for _, id := range []uuid.UUID{nil, NilUUID} {
+		if _, err := r.ListByOwner(context.Background(), id); err == nil {
+			t.Fatalf("Expected an error for the owner %q", id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql/driver"
+
+	"github.com/pkg/errors"
+)
+
+// Role is the role of a user within an organization or a team.
+type Role string
+
+// Known roles.
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleViewer Role = "viewer"
+)
+
+// Valid returns true if the role is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleOwner, RoleAdmin, RoleMember, RoleViewer:
+		return true
+	default:
+		return false
+	}
+}
+
+// legacyRoleUser is the former default membership role, now RoleMember.
+// The rows written before the rename may still carry it.
+const legacyRoleUser = "user"
+
+// ParseRole returns the Role for the given string.
+// The legacy "user" role is read as RoleMember. Unknown roles are rejected with ErrInvalidRole.
+func ParseRole(s string) (Role, error) {
+	if s == legacyRoleUser {
+		return RoleMember, nil
+	}
+	r := Role(s)
+	if !r.Valid() {
+		return "", errors.Wrapf(ErrInvalidRole, "unknown role %q", s)
+	}
+	return r, nil
+}
+
+// Action is an operation a role may be allowed to perform.
+type Action string
+
+// Known actions.
+const (
+	ActionRead          Action = "read"
+	ActionWrite         Action = "write"
+	ActionManageMembers Action = "manage_members"
+	ActionBilling       Action = "billing"
+)
+
+// roleRanks orders the roles: each role can do what the lower ones can.
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// actionRoles maps each action to the lowest role allowed to perform it.
+var actionRoles = map[Action]Role{
+	ActionRead:          RoleViewer,
+	ActionWrite:         RoleMember,
+	ActionManageMembers: RoleAdmin,
+	ActionBilling:       RoleOwner,
+}
+
+// Can returns true if the role is allowed to perform the given action.
+// Unknown roles and actions are never allowed.
+func (r Role) Can(action Action) bool {
+	minRole, ok := actionRoles[action]
+	if !ok {
+		return false
+	}
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[minRole]
+}
+
+// Scan implements sql.Scanner interface.
+// It reads text and postgres enum columns alike, rejecting unknown roles with ErrInvalidRole.
+func (r *Role) Scan(src interface{}) error {
+	s, err := ScanToString(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for Role scan")
+	}
+	role, err := ParseRole(s)
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// Value implements driver.Valuer interface.
+// It emits the bare role string, valid for both text and postgres enum columns.
+func (r Role) Value() (driver.Value, error) {
+	if !r.Valid() {
+		return nil, errors.Wrapf(ErrInvalidRole, "unknown role %q", string(r))
+	}
+	return string(r), nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, r := range []Role{RoleOwner, RoleAdmin, RoleMember, RoleViewer} {
+		got, err := ParseRole(string(r))
+		if err != nil || got != r || !r.Valid() {
+			t.Fatalf("Expected %s to be valid, got %q, %v", r, got, err)
+		}
+	}
+	if got, err := ParseRole("user"); err != nil || got != RoleMember {
+		t.Fatalf("Expected the legacy user role to be read as member, got %q, %v", got, err)
+	}
+	for _, s := range []string{"", "Admin", "root"} {
+		if _, err := ParseRole(s); errors.Cause(err) != ErrInvalidRole {
+			t.Fatalf("%q: expected ErrInvalidRole, got %v", s, err)
+		}
+	}
+
+	var uo UserOrganization
+	err := uo.Scan(`(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,root,"(,2020-01-02,2020-01-02,)")`)
+	if errors.Cause(err) != ErrInvalidRole {
+		t.Fatalf("Expected ErrInvalidRole scanning an unknown role, got %v", err)
+	}
+}
+
+func TestRoleJSON(t *testing.T) {
+	buf, err := json.Marshal(RoleAdmin)
+	if err != nil || string(buf) != `"admin"` {
+		t.Fatalf(`Expected "admin", got %s, %v`, buf, err)
+	}
+}
+
+func TestRoleScanValue(t *testing.T) {
+	for _, src := range []interface{}{"admin", []byte("admin")} {
+		var r Role
+		if err := r.Scan(src); err != nil {
+			t.Fatalf("Error scanning %v: %s", src, err)
+		}
+		if r != RoleAdmin {
+			t.Fatalf("Expected admin, got %q", r)
+		}
+		v, err := r.Value()
+		if err != nil || v != "admin" {
+			t.Fatalf("Expected the bare admin value, got %v (%v)", v, err)
+		}
+	}
+
+	r := RoleMember
+	if err := r.Scan("superuser"); errors.Cause(err) != ErrInvalidRole {
+		t.Fatalf("Expected ErrInvalidRole, got %v", err)
+	}
+	if r != RoleMember {
+		t.Fatalf("Expected an invalid scan to leave the role unchanged, got %q", r)
+	}
+	if _, err := Role("superuser").Value(); errors.Cause(err) != ErrInvalidRole {
+		t.Fatalf("Expected ErrInvalidRole, got %v", err)
+	}
+	if err := r.Scan(42); err == nil {
+		t.Fatal("Expected an error scanning an int")
+	}
+}
+
+func TestRoleCan(t *testing.T) {
+	actions := []Action{ActionRead, ActionWrite, ActionManageMembers, ActionBilling}
+	for _, tc := range []struct {
+		role   Role
+		expect []bool // Indexed like actions.
+	}{
+		{RoleOwner, []bool{true, true, true, true}},
+		{RoleAdmin, []bool{true, true, true, false}},
+		{RoleMember, []bool{true, true, false, false}},
+		{RoleViewer, []bool{true, false, false, false}},
+		{Role("superuser"), []bool{false, false, false, false}},
+	} {
+		for i, action := range actions {
+			if got := tc.role.Can(action); got != tc.expect[i] {
+				t.Errorf("%s.Can(%s): expected %t, got %t", tc.role, action, tc.expect[i], got)
+			}
+		}
+		if tc.role.Can(Action("delete")) {
+			t.Errorf("%s: expected an unknown action to be denied", tc.role)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+// JSONSchema returns the JSON Schema of the JSON representation of the given model, i.e. JSONSchema(User{}).
+// It follows the `json` tags, the fields without `omitempty` being required,
+// and the custom marshalers: the metadata is flattened with optional `owner_id` and `created_by`,
+// or the inline `owner` object instead of `owner_id` with MarshalOwnerInline,
+// the PaymentPlan metadata is inlined and the UserOrganization ids and metadata are optional.
+// UUIDs are `uuid` formatted strings and timestamps `date-time` formatted ones.
+func JSONSchema(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, errors.New("invalid nil value for JSONSchema")
+	}
+	schema := newSchemaBuilder().schema(reflect.TypeOf(v))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+
+	buf, err := json.Marshal(schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding JSON schema")
+	}
+	return buf, nil
+}
+
+// schemaOptional lists the fields made optional by a custom MarshalJSON despite having no `omitempty`.
+var schemaOptional = map[reflect.Type][]string{
+	reflect.TypeOf(UserOrganization{}): {"user_id", "organization_id", "metadata"},
+}
+
+// schemaBuilder builds the JSON schemas, tracking the types being built to cut the cycles,
+// i.e. a Team pointing back to its Organization.
+type schemaBuilder struct {
+	building map[reflect.Type]bool
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{building: map[reflect.Type]bool{}}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(uuid.UUID{}):
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(Timestamp{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(Role("")):
+		return map[string]interface{}{"type": "string", "enum": []Role{RoleOwner, RoleAdmin, RoleMember, RoleViewer}}
+	case reflect.TypeOf(Term("")):
+		return map[string]interface{}{"type": "string", "enum": []Term{TermDaily, TermWeekly, TermMonthly, TermYearly}}
+	case reflect.TypeOf(Metadata{}):
+		return map[string]interface{}{"type": "object", "properties": b.metadataProperties()}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Struct:
+		return b.structSchema(t)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// metadataProperties returns the flattened metadata properties, all optional.
+// The owner is either its `owner_id` or, with MarshalOwnerInline, the inline `owner` user.
+func (b *schemaBuilder) metadataProperties() map[string]interface{} {
+	timestamp := b.schema(reflect.TypeOf(Timestamp{}))
+	return map[string]interface{}{
+		"owner":      b.schema(reflect.TypeOf(User{})),
+		"owner_id":   b.schema(reflect.TypeOf(uuid.UUID{})),
+		"created_by": b.schema(reflect.TypeOf(uuid.UUID{})),
+		"created_at": timestamp,
+		"updated_at": timestamp,
+		"deleted_at": timestamp,
+	}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	if b.building[t] {
+		return map[string]interface{}{"type": "object"}
+	}
+	b.building[t] = true
+	defer delete(b.building, t)
+
+	props := map[string]interface{}{}
+	required := []string{}
+	optional := map[string]bool{}
+	for _, name := range schemaOptional[t] {
+		optional[name] = true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if f.Anonymous && name == "" && f.Type == reflect.TypeOf(Metadata{}) {
+			// Inlined by the PaymentPlan custom marshaler.
+			for k, v := range b.metadataProperties() {
+				props[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+
+		omitempty := false
+		for _, opt := range opts[1:] {
+			omitempty = omitempty || opt == "omitempty"
+		}
+		if !omitempty && !optional[name] {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	schema := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// jsonSchema is the subset of a JSON schema the tests look at.
+type jsonSchema struct {
+	Type       string                 `json:"type"`
+	Format     string                 `json:"format"`
+	Required   []string               `json:"required"`
+	Properties map[string]*jsonSchema `json:"properties"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	for _, tc := range []struct {
+		v        interface{}
+		required []string
+	}{
+		{User{}, []string{"metadata", "user_id"}},
+		{&PaymentPlan{}, []string{"cost", "currency", "name", "payment_plan_id", "term"}},
+	} {
+		buf, err := JSONSchema(tc.v)
+		if err != nil {
+			t.Fatalf("Error generating the %T schema: %s", tc.v, err)
+		}
+		var schema jsonSchema
+		if err := json.Unmarshal(buf, &schema); err != nil {
+			t.Fatalf("Error decoding %s: %s", buf, err)
+		}
+		if !reflect.DeepEqual(schema.Required, tc.required) {
+			t.Fatalf("%T: expected required %v, got %v", tc.v, tc.required, schema.Required)
+		}
+
+		metadata := schema.Properties["metadata"]
+		if _, ok := tc.v.(*PaymentPlan); ok {
+			metadata = &schema // Inlined.
+		}
+		for _, key := range []string{"owner", "owner_id", "deleted_at", "created_by"} {
+			if metadata.Properties[key] == nil {
+				t.Fatalf("%T: missing metadata %s in %s", tc.v, key, buf)
+			}
+			for _, required := range metadata.Required {
+				if required == key {
+					t.Fatalf("%T: expected %s to be optional", tc.v, key)
+				}
+			}
+		}
+		if p := metadata.Properties["owner_id"]; p.Type != "string" || p.Format != "uuid" {
+			t.Fatalf("%T: unexpected owner_id schema %+v", tc.v, p)
+		}
+		if p := metadata.Properties["owner"]; p.Type != "object" {
+			t.Fatalf("%T: unexpected owner schema %+v", tc.v, p)
+		}
+		if p := metadata.Properties["deleted_at"]; p.Type != "string" || p.Format != "date-time" {
+			t.Fatalf("%T: unexpected deleted_at schema %+v", tc.v, p)
+		}
+	}
+
+	buf, err := JSONSchema(User{})
+	if err != nil {
+		t.Fatalf("Error generating the User schema: %s", err)
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal(buf, &schema); err != nil {
+		t.Fatalf("Error decoding %s: %s", buf, err)
+	}
+	if p := schema.Properties["user_id"]; p == nil || p.Type != "string" || p.Format != "uuid" {
+		t.Fatalf("Unexpected user_id schema %+v", p)
+	}
+
+	if _, err := JSONSchema(nil); err == nil {
+		t.Fatal("Expected an error for a nil value")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/creack/uuid"
+)
+
+// String implements fmt.Stringer interface.
+// i.e. `User{1b4e28ba orgs=2 teams=1 deleted}`.
+func (u User) String() string {
+	b := strings.Builder{}
+	b.Grow(64)
+	b.WriteString("User{")
+	writeShortID(&b, u.ID)
+	b.WriteString(" orgs=")
+	b.WriteString(strconv.Itoa(len(u.Organizations)))
+	b.WriteString(" teams=")
+	b.WriteString(strconv.Itoa(len(u.Teams)))
+	writeDeleted(&b, u.Metadata)
+	b.WriteByte('}')
+	return b.String()
+}
+
+// String implements fmt.Stringer interface.
+// i.e. `Organization{1b4e28ba users=3 teams=1}`.
+func (o Organization) String() string {
+	b := strings.Builder{}
+	b.Grow(64)
+	b.WriteString("Organization{")
+	writeShortID(&b, o.ID)
+	b.WriteString(" users=")
+	b.WriteString(strconv.Itoa(len(o.Users)))
+	b.WriteString(" teams=")
+	b.WriteString(strconv.Itoa(len(o.Teams)))
+	writeDeleted(&b, o.Metadata)
+	b.WriteByte('}')
+	return b.String()
+}
+
+// String implements fmt.Stringer interface.
+// i.e. `Team{1b4e28ba "devs" users=2/5}`, the capacity is omitted when unlimited.
+func (t Team) String() string {
+	b := strings.Builder{}
+	b.Grow(64 + len(t.Name))
+	b.WriteString("Team{")
+	writeShortID(&b, t.ID)
+	b.WriteString(" ")
+	b.WriteString(strconv.Quote(t.Name))
+	b.WriteString(" users=")
+	b.WriteString(strconv.Itoa(len(t.Users)))
+	if !t.CapacityNull && t.Capacity > 0 {
+		b.WriteByte('/')
+		b.WriteString(strconv.Itoa(t.Capacity))
+	}
+	writeDeleted(&b, t.Metadata)
+	b.WriteByte('}')
+	return b.String()
+}
+
+// String implements fmt.Stringer interface.
+// i.e. `UserOrganization{user=1b4e28ba org=6ba7b810 role=admin}`.
+func (uo UserOrganization) String() string {
+	b := strings.Builder{}
+	b.Grow(64)
+	b.WriteString("UserOrganization{user=")
+	writeShortID(&b, uo.UserID)
+	b.WriteString(" org=")
+	writeShortID(&b, uo.OrganizationID)
+	b.WriteString(" role=")
+	b.WriteString(string(uo.Role))
+	writeDeleted(&b, uo.Metadata)
+	b.WriteByte('}')
+	return b.String()
+}
+
+// String implements fmt.Stringer interface.
+// i.e. `PaymentPlan{1b4e28ba "pro" 19.99 USD Monthly}`.
+func (pp PaymentPlan) String() string {
+	b := strings.Builder{}
+	b.Grow(64 + len(pp.Name))
+	b.WriteString("PaymentPlan{")
+	writeShortID(&b, pp.ID)
+	b.WriteString(" ")
+	b.WriteString(strconv.Quote(pp.Name))
+	b.WriteString(" ")
+	b.WriteString(pp.FormattedCost())
+	b.WriteString(" ")
+	b.WriteString(string(pp.Term))
+	writeDeleted(&b, pp.Metadata)
+	b.WriteByte('}')
+	return b.String()
+}
+
+// writeShortID writes the first 8 hex digits of the given UUID, `<nil>` when unset.
+func writeShortID(b *strings.Builder, id uuid.UUID) {
+	if len(id) < 4 {
+		b.WriteString("<nil>")
+		return
+	}
+	var buf [8]byte
+	hex.Encode(buf[:], id[:4])
+	b.Write(buf[:])
+}
+
+// writeDeleted writes the soft-deleted flag.
+func writeDeleted(b *strings.Builder, m Metadata) {
+	if m.IsDeleted() {
+		b.WriteString(" deleted")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/creack/uuid"
+)
+
+func TestStringers(t *testing.T) {
+	id := uuid.Parse("1b4e28ba-2fa1-11d2-883f-0016d3cca427")
+	orgID := uuid.Parse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	deleted := Metadata{}
+	deleted.Delete()
+
+	for _, tc := range []struct {
+		value  fmt.Stringer
+		expect string
+	}{
+		{User{ID: id, Organizations: UserOrganizations{{}, {}}, Teams: []UserTeam{{}}, Metadata: deleted}, `User{1b4e28ba orgs=2 teams=1 deleted}`},
+		{User{}, `User{<nil> orgs=0 teams=0}`},
+		{Organization{ID: orgID, Users: OrganizationUsers{{}, {}, {}}}, `Organization{6ba7b810 users=3 teams=0}`},
+		{Team{ID: id, Name: "devs", Users: TeamUsers{{}, {}}, Capacity: 5}, `Team{1b4e28ba "devs" users=2/5}`},
+		{Team{ID: id, Name: "devs", Capacity: 5, CapacityNull: true}, `Team{1b4e28ba "devs" users=0}`},
+		{UserOrganization{UserID: id, OrganizationID: orgID, Role: RoleAdmin}, `UserOrganization{user=1b4e28ba org=6ba7b810 role=admin}`},
+		{PaymentPlan{ID: id, Name: "pro", Cost: 19.99, Currency: "USD", Term: TermMonthly}, `PaymentPlan{1b4e28ba "pro" 19.99 USD Monthly}`},
+	} {
+		if got := tc.value.String(); got != tc.expect {
+			t.Errorf("Unexpected String(): %s, expected %s", got, tc.expect)
+		}
+		if got := fmt.Sprintf("%v", tc.value); got != tc.expect {
+			t.Errorf("Unexpected %%v: %s, expected %s", got, tc.expect)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+// NewTeam instantiates a new Team with a random id and fresh timestamps.
+// A capacity of 0 means no limit.
+func NewTeam(name string, capacity int) *Team {
+	t := &Team{
+		ID:       newUUID(),
+		Name:     name,
+		Capacity: capacity,
+	}
+	t.Metadata.Touch()
+	return t
+}
+
+// HasCapacity returns true if the team can accept one more user.
+// A NULL Capacity or a Capacity of 0 means no limit.
+func (t *Team) HasCapacity() bool {
+	return t.CapacityNull || t.Capacity == 0 || len(t.Users) < t.Capacity
+}
+
+// AddUser adds the given membership to the team.
+// Returns ErrAlreadyMember if the user is already in the team and ErrTeamFull if the team reached its capacity.
+func (t *Team) AddUser(ut *UserTeam) error {
+	if ut == nil {
+		return errors.Errorf("nil membership for team %s", t.ID)
+	}
+	if t.indexOf(ut.UserID) >= 0 {
+		return errors.Wrapf(ErrAlreadyMember, "user %s in team %s", ut.UserID, t.ID)
+	}
+	if !t.HasCapacity() {
+		return errors.Wrapf(ErrTeamFull, "team %s", t.ID)
+	}
+	t.Users = append(t.Users, ut)
+	return nil
+}
+
+// RemoveUser removes the memberships of the given user from the team.
+// Returns false if the user was not in the team.
+func (t *Team) RemoveUser(userID uuid.UUID) bool {
+	users := make(TeamUsers, 0, len(t.Users))
+	for _, ut := range t.Users {
+		if ut == nil || !uuid.Equal(ut.UserID, userID) {
+			users = append(users, ut)
+		}
+	}
+	if len(users) == len(t.Users) {
+		return false
+	}
+	t.Users = users
+	return true
+}
+
+// Dedup collapses the memberships of a same user into the last one, keeping the team order otherwise.
+func (t *Team) Dedup() {
+	last := map[string]int{}
+	for i, ut := range t.Users {
+		if ut != nil {
+			last[ut.UserID.String()] = i
+		}
+	}
+	users := make(TeamUsers, 0, len(last))
+	for i, ut := range t.Users {
+		if ut == nil || last[ut.UserID.String()] == i {
+			users = append(users, ut)
+		}
+	}
+	t.Users = users
+}
+
+// indexOf returns the index of the first membership of the given user, -1 if none.
+func (t *Team) indexOf(userID uuid.UUID) int {
+	for i, ut := range t.Users {
+		if ut != nil && uuid.Equal(ut.UserID, userID) {
+			return i
+		}
+	}
+	return -1
+}
+
+// MoveUser moves the membership of the given user from one team to the other.
+// Returns ErrNotMember if the user is not in the source team, ErrAlreadyMember if it is in the destination one
+// and ErrTeamFull if the destination reached its capacity, in which case both teams are left unchanged.
+func MoveUser(from, to *Team, userID uuid.UUID) error {
+	idx := from.indexOf(userID)
+	if idx < 0 {
+		return errors.Wrapf(ErrNotMember, "user %s in team %s", userID, from.ID)
+	}
+	if from == to {
+		return nil
+	}
+	if to.indexOf(userID) >= 0 {
+		return errors.Wrapf(ErrAlreadyMember, "user %s in team %s", userID, to.ID)
+	}
+	if !to.HasCapacity() {
+		return errors.Wrapf(ErrTeamFull, "team %s", to.ID)
+	}
+
+	ut := from.Users[idx]
+	users := make(TeamUsers, 0, len(from.Users)-1)
+	users = append(users, from.Users[:idx]...)
+	from.Users = append(users, from.Users[idx+1:]...)
+	to.Users = append(to.Users, ut)
+	return nil
+}
+
+// Scan implements sql.Scanner interface.
+// It expects a `(team_id,organization_id,name,capacity,owner_id,created_at,updated_at,deleted_at)` composite.
+// A NULL capacity sets CapacityNull and a NULL organization_id, i.e. a team selected on its own, a nil Organization.
+// The team users are not part of the composite.
+func (t *Team) Scan(src interface{}) error {
+	b, err := scanToBytes(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for Team scan")
+	}
+
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing Team composite")
+	}
+	if len(parts) != 8 {
+		return countError("Team", 8, len(parts), string(b))
+	}
+
+	t.ID = uuid.Parse(parts[0].String)
+	if t.ID == nil {
+		return errors.New("invalid team_id")
+	}
+	t.Organization = nil
+	if parts[1].Valid {
+		organizationID := uuid.Parse(parts[1].String)
+		if organizationID == nil {
+			return errors.New("invalid organization_id")
+		}
+		t.Organization = &Organization{ID: organizationID}
+	}
+	t.Name = parts[2].String
+	if t.Name == "" {
+		return errors.New("invalid name")
+	}
+	t.Capacity, t.CapacityNull = 0, !parts[3].Valid
+	if parts[3].Valid {
+		if t.Capacity, err = strconv.Atoi(parts[3].String); err != nil {
+			return errors.Wrap(err, "invalid capacity")
+		}
+	}
+	if err := t.Metadata.scanFields(parts[4:]); err != nil {
+		return errors.Wrap(err, "error scan Metadata for Team")
+	}
+	if StrictScan {
+		if err := t.Validate(); err != nil {
+			return errors.Wrap(err, "invalid Team")
+		}
+	}
+
+	return nil
+}
+
+// Teams .
+type Teams []*Team
+
+// Scan implement sql.Scanner interface.
+// It expects an `array_agg` of Team composites, i.e. `array_agg(teamrow)`.
+// Each team must have a valid team_id and a name.
+// NULL elements are skipped and the order of the array is preserved.
+func (ts *Teams) Scan(src interface{}) error {
+	strArray, err := parseArray(src)
+	if err != nil {
+		return err
+	}
+
+	for _, elem := range strArray {
+		t := &Team{}
+		if err := t.Scan(elem); err != nil {
+			return errors.Wrap(err, "error parsing db result element into team")
+		}
+		*ts = append(*ts, t)
+	}
+	return nil
+}
+
+// Scan implements sql.Scanner interface.
+// The UserTeam composite is the UserOrganization one followed by the team_id, see teamMembershipComposite:
+// `(user_id,organization_id,role,metadata,team_id)`. A NULL team_id leaves TeamID nil.
+func (ut *UserTeam) Scan(src interface{}) error {
+	b, err := scanToBytes(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for UserTeam scan")
+	}
+
+	parts, err := parseCompositeBytes(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing UserTeam composite")
+	}
+	if len(parts) != 5 {
+		return countError("UserTeam", 5, len(parts), string(b))
+	}
+	var teamID uuid.UUID
+	if parts[4].Valid {
+		if teamID = uuid.Parse(parts[4].String); teamID == nil {
+			return errors.New("invalid team_id")
+		}
+	}
+
+	uo := UserOrganization{}
+	if err := uo.scanFields(parts[:4]); err != nil {
+		return errors.Wrap(err, "error scan UserTeam")
+	}
+	*ut = UserTeam{
+		UserID:         uo.UserID,
+		OrganizationID: uo.OrganizationID,
+		TeamID:         teamID,
+		Role:           uo.Role,
+		Metadata:       uo.Metadata,
+	}
+	return nil
+}
+
+// Value implements driver.Valuer interface.
+// It emits the `(user_id,organization_id,role,metadata,team_id)` composite expected by Scan, with a NULL team_id when unset.
+func (ut UserTeam) Value() (driver.Value, error) {
+	uo := UserOrganization{UserID: ut.UserID, OrganizationID: ut.OrganizationID, Role: ut.Role, Metadata: ut.Metadata}
+	fields, err := uo.compositeFields()
+	if err != nil {
+		return nil, errors.Wrap(err, "error value UserTeam")
+	}
+	var teamID string
+	if ut.TeamID != nil {
+		teamID = ut.TeamID.String()
+	}
+	return "(" + strings.Join(append(fields, teamID), ",") + ")", nil
+}
+
+// TeamUsers .
+type TeamUsers []*UserTeam
+
+// Scan implement sql.Scanner interface.
+// It expects an `array_agg` of UserTeam composites. NULL elements are skipped.
+func (tus *TeamUsers) Scan(src interface{}) error {
+	strArray, err := parseArray(src)
+	if err != nil {
+		return err
+	}
+
+	for _, elem := range strArray {
+		ut := &UserTeam{}
+		if err := ut.Scan(elem); err != nil {
+			return errors.Wrap(err, "error parsing db result element into team user")
+		}
+		*tus = append(*tus, ut)
+	}
+	return nil
+}
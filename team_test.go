@@ -0,0 +1,300 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+func TestUserTeamScanValue(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	for _, teamID := range []uuid.UUID{nil, MustParseUUID("00000000-0000-0000-0000-00000000000c")} {
+		ut := UserTeam{
+			UserID:         MustParseUUID("00000000-0000-0000-0000-00000000000a"),
+			OrganizationID: MustParseUUID("00000000-0000-0000-0000-00000000000b"),
+			TeamID:         teamID,
+			Role:           RoleAdmin,
+			Metadata:       Metadata{TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}},
+		}
+		v, err := ut.Value()
+		if err != nil {
+			t.Fatalf("Error encoding UserTeam: %s", err)
+		}
+		var scanned UserTeam
+		if err := scanned.Scan(v); err != nil {
+			t.Fatalf("Error scanning %v: %s", v, err)
+		}
+		if !scanned.Equal(&ut) {
+			t.Fatalf("Expected %v, got %v", ut, scanned)
+		}
+	}
+
+	var ut UserTeam
+	if err := ut.Scan(`(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,member,"(,,,)",nope)`); err == nil {
+		t.Fatal("Expected an error for an invalid team_id")
+	}
+	for _, src := range []string{
+		// The bare membership composite, without team_id.
+		`(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,member,"(,,,)")`,
+		// The flat user_organization_join row.
+		`(00000000-0000-0000-0000-00000000000b,00000000-0000-0000-0000-00000000000a,member,,"2020-01-02 03:04:05+00","2020-01-02 03:04:05+00",)`,
+	} {
+		if err := ut.Scan(src); !errors.Is(err, ErrInvalidCount) {
+			t.Fatalf("%s: expected ErrInvalidCount, got %v", src, err)
+		}
+	}
+}
+
+func TestTeamAddUserCapacity(t *testing.T) {
+	member := func(id string) *UserTeam {
+		return &UserTeam{UserID: MustParseUUID(id), Role: RoleMember}
+	}
+
+	unlimited := NewTeam("unlimited", 0)
+	for _, id := range []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002", "00000000-0000-0000-0000-000000000003"} {
+		if err := unlimited.AddUser(member(id)); err != nil {
+			t.Fatalf("Unexpected error adding to an unlimited team: %s", err)
+		}
+	}
+
+	team := NewTeam("pair", 2)
+	if err := team.AddUser(member("00000000-0000-0000-0000-000000000001")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !team.HasCapacity() {
+		t.Fatal("Expected a half-full team to have capacity")
+	}
+	if err := team.AddUser(member("00000000-0000-0000-0000-000000000002")); err != nil {
+		t.Fatalf("Unexpected error filling the team: %s", err)
+	}
+	if team.HasCapacity() {
+		t.Fatal("Expected an exactly full team to have no capacity")
+	}
+	if err := team.AddUser(member("00000000-0000-0000-0000-000000000003")); errors.Cause(err) != ErrTeamFull {
+		t.Fatalf("Expected ErrTeamFull, got %v", err)
+	}
+	if len(team.Users) != 2 {
+		t.Fatalf("Expected the rejected user not to be added, got %d users", len(team.Users))
+	}
+	if err := unlimited.AddUser(nil); err == nil {
+		t.Fatal("Expected an error adding a nil membership")
+	}
+}
+
+// teamElement returns the array_agg element of a team of the organization 0b.
+func teamElement(id, name string) string {
+	return `"(` + id + `,00000000-0000-0000-0000-00000000000b,\"` + name + `\",3,,2020-01-02,2020-01-02,)"`
+}
+
+// userTeamElement returns the array_agg element of a member of a team of the organization 0b.
+func userTeamElement(userID string) string {
+	return `"(` + userID + `,00000000-0000-0000-0000-00000000000b,member,\"(,2020-01-02,2020-01-02,)\",)"`
+}
+
+func TestOrganizationTeamsScan(t *testing.T) {
+	src := `{` + teamElement("00000000-0000-0000-0000-000000000001", "core") + `,` +
+		teamElement("00000000-0000-0000-0000-000000000002", "ops, on call") + `}`
+
+	var ts Teams
+	if err := ts.Scan([]byte(src)); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if len(ts) != 2 || ts[0].Name != "core" || ts[1].Name != "ops, on call" || ts[1].Capacity != 3 {
+		t.Fatalf("Unexpected teams %v", ts)
+	}
+	if ts[0].Organization == nil || ts[0].Organization.ID.String() != "00000000-0000-0000-0000-00000000000b" {
+		t.Fatalf("Unexpected team organization %v", ts[0].Organization)
+	}
+}
+
+func TestTeamUsersScan(t *testing.T) {
+	src := `{` + userTeamElement("00000000-0000-0000-0000-000000000001") + `,` +
+		userTeamElement("00000000-0000-0000-0000-000000000002") + `,` +
+		userTeamElement("00000000-0000-0000-0000-000000000003") + `}`
+
+	var tus TeamUsers
+	if err := tus.Scan([]byte(src)); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if len(tus) != 3 {
+		t.Fatalf("Expected 3 members, got %v", tus)
+	}
+	for i, ut := range tus {
+		if expect := "00000000-0000-0000-0000-00000000000" + string(rune('1'+i)); ut.UserID.String() != expect || ut.Role != RoleMember {
+			t.Fatalf("Unexpected member %d: %v", i, ut)
+		}
+	}
+}
+
+func TestTeamsScanOrderAndNull(t *testing.T) {
+	src := `{` + teamElement("00000000-0000-0000-0000-000000000003", "c") + `,` +
+		teamElement("00000000-0000-0000-0000-000000000001", "a") + `,` +
+		teamElement("00000000-0000-0000-0000-000000000002", "b") + `,NULL}`
+
+	var ts Teams
+	if err := ts.Scan([]byte(src)); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if len(ts) != 3 || ts[0].Name != "c" || ts[1].Name != "a" || ts[2].Name != "b" {
+		t.Fatalf("Expected the 3 teams in the array order, got %v", ts)
+	}
+
+	for _, elem := range []string{
+		teamElement("nope", "a"),
+		teamElement("00000000-0000-0000-0000-000000000001", ""),
+	} {
+		var ts Teams
+		if err := ts.Scan([]byte(`{` + elem + `}`)); err == nil {
+			t.Fatalf("Expected an error scanning %s", elem)
+		}
+	}
+}
+
+func TestMoveUser(t *testing.T) {
+	id1 := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	id2 := MustParseUUID("00000000-0000-0000-0000-000000000002")
+	newTeams := func(capacity int) (*Team, *Team) {
+		from, to := NewTeam("from", 0), NewTeam("to", capacity)
+		from.Users = TeamUsers{{UserID: id1, Role: RoleMember}}
+		to.Users = TeamUsers{{UserID: id2, Role: RoleMember}}
+		return from, to
+	}
+
+	from, to := newTeams(2)
+	if err := MoveUser(from, to, id1); err != nil {
+		t.Fatalf("Unexpected error moving user: %s", err)
+	}
+	if len(from.Users) != 0 || len(to.Users) != 2 || !uuid.Equal(to.Users[1].UserID, id1) {
+		t.Fatalf("Unexpected teams after move: %v, %v", from.Users, to.Users)
+	}
+
+	for _, tc := range []struct {
+		capacity int
+		userID   uuid.UUID
+		expect   error
+	}{
+		{capacity: 1, userID: id1, expect: ErrTeamFull},
+		{capacity: 2, userID: id2, expect: ErrNotMember},
+	} {
+		from, to := newTeams(tc.capacity)
+		if err := MoveUser(from, to, tc.userID); errors.Cause(err) != tc.expect {
+			t.Fatalf("Expected %v, got %v", tc.expect, err)
+		}
+		if len(from.Users) != 1 || len(to.Users) != 1 {
+			t.Fatalf("Expected both teams unchanged, got %v, %v", from.Users, to.Users)
+		}
+	}
+
+	from, to = newTeams(0)
+	to.Users = append(to.Users, &UserTeam{UserID: id1, Role: RoleMember})
+	if err := MoveUser(from, to, id1); errors.Cause(err) != ErrAlreadyMember {
+		t.Fatalf("Expected ErrAlreadyMember, got %v", err)
+	}
+}
+
+func TestTeamRemoveUserDedup(t *testing.T) {
+	id1 := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	id2 := MustParseUUID("00000000-0000-0000-0000-000000000002")
+
+	team := NewTeam("devs", 0)
+	team.Users = TeamUsers{
+		{UserID: id1, Role: RoleMember},
+		{UserID: id2, Role: RoleMember},
+		{UserID: id1, Role: RoleAdmin},
+	}
+	team.Dedup()
+	if len(team.Users) != 2 || !uuid.Equal(team.Users[0].UserID, id2) || team.Users[1].Role != RoleAdmin {
+		t.Fatalf("Expected the last membership of each user to be kept, got %v", team.Users)
+	}
+
+	if err := team.AddUser(&UserTeam{UserID: id2, Role: RoleViewer}); errors.Cause(err) != ErrAlreadyMember {
+		t.Fatalf("Expected ErrAlreadyMember, got %v", err)
+	}
+	if len(team.Users) != 2 {
+		t.Fatalf("Expected the duplicate not to be added, got %v", team.Users)
+	}
+
+	if team.RemoveUser(MustParseUUID("00000000-0000-0000-0000-000000000003")) {
+		t.Fatal("Expected removing a missing user to return false")
+	}
+	if !team.RemoveUser(id1) || len(team.Users) != 1 || !uuid.Equal(team.Users[0].UserID, id2) {
+		t.Fatalf("Unexpected users after removal: %v", team.Users)
+	}
+}
+
+func TestTeamScanCapacity(t *testing.T) {
+	const ts = `"2020-01-02 03:04:05+00"`
+	for _, tc := range []struct {
+		capacity string
+		expect   int
+		null     bool
+	}{
+		{capacity: "", expect: 0, null: true},
+		{capacity: "0", expect: 0},
+		{capacity: "2", expect: 2},
+	} {
+		var team Team
+		src := `(00000000-0000-0000-0000-00000000000c,00000000-0000-0000-0000-00000000000b,devs,` + tc.capacity + `,,` + ts + `,` + ts + `,)`
+		if err := team.Scan(src); err != nil {
+			t.Fatalf("Error scanning %s: %s", src, err)
+		}
+		if team.Capacity != tc.expect || team.CapacityNull != tc.null {
+			t.Fatalf("%q: unexpected capacity %d (null: %t)", tc.capacity, team.Capacity, team.CapacityNull)
+		}
+
+		// Both NULL and 0 mean unlimited.
+		team.Users = TeamUsers{{}, {}, {}}
+		if unlimited := tc.expect == 0; team.HasCapacity() != unlimited {
+			t.Fatalf("%q: expected HasCapacity %t with 3 users", tc.capacity, unlimited)
+		}
+	}
+
+	if err := new(Team).Scan(`(00000000-0000-0000-0000-00000000000c,,devs,many,,` + ts + `,` + ts + `,)`); err == nil {
+		t.Fatal("Expected an error for an invalid capacity")
+	}
+}
+
+func TestUserTeamScanMetadata(t *testing.T) {
+	var ut UserTeam
+	src := `(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,viewer,"(00000000-0000-0000-0000-000000000001,""2020-01-02 03:04:05+00"",""2020-01-02 03:04:05+00"",""2020-01-03 03:04:05+00"")",)`
+	if err := ut.Scan([]byte(src)); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if ut.Role != RoleViewer || ut.TeamID != nil {
+		t.Fatalf("Unexpected membership %v", ut)
+	}
+	if ut.Metadata.Owner == nil || ut.Metadata.Owner.ID.String() != "00000000-0000-0000-0000-000000000001" || !ut.Metadata.IsDeleted() {
+		t.Fatalf("Unexpected metadata %+v", ut.Metadata)
+	}
+
+	// The metadata maps by tag like the other memberships.
+	if got := dbPath(reflect.TypeOf(UserTeam{}), "Metadata"); got != "metadata" {
+		t.Fatalf("Expected the metadata db tag, got %q", got)
+	}
+}
+
+func TestTeamScanNullOrganization(t *testing.T) {
+	const ts = `"2020-01-02 03:04:05+00"`
+	var team Team
+	src := `(00000000-0000-0000-0000-00000000000c,,"core team",3,00000000-0000-0000-0000-000000000001,` + ts + `,` + ts + `,)`
+	if err := team.Scan([]byte(src)); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if team.Organization != nil {
+		t.Fatalf("Expected a nil organization, got %v", team.Organization)
+	}
+	if team.Name != "core team" || team.Capacity != 3 || team.Metadata.Owner == nil || team.Metadata.CreatedAt.IsZero() {
+		t.Fatalf("Unexpected team %+v", team)
+	}
+
+	src = `(00000000-0000-0000-0000-00000000000c,00000000-0000-0000-0000-00000000000b,core,3,,` + ts + `,` + ts + `,)`
+	if err := team.Scan([]byte(src)); err != nil {
+		t.Fatalf("Error scanning %s: %s", src, err)
+	}
+	if team.Organization == nil || team.Organization.ID.String() != "00000000-0000-0000-0000-00000000000b" {
+		t.Fatalf("Unexpected organization %v", team.Organization)
+	}
+}
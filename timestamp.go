@@ -0,0 +1,208 @@
+package main
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// parseTimestamp parses a postgres timestamp into ScanLocation.
+// Common variants not handled by pq.ParseTimestamp are normalized first:
+// a `T` date/time separator, a lower-case `z`, a space before the offset and `+hhmm` offsets.
+// pq.ParseTimestamp only uses its location when the offsets match, so the result is converted explicitly.
+func parseTimestamp(s string) (time.Time, error) {
+	t, err := pq.ParseTimestamp(ScanLocation, normalizeTimestamp(s))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(ScanLocation), nil
+}
+
+// normalizeTimestamp rewrites the given timestamp in the `2006-01-02 15:04:05.999999-07:00` form.
+func normalizeTimestamp(s string) string {
+	const dateLen = len("2006-01-02")
+
+	s = strings.TrimSpace(s)
+	if len(s) > dateLen && (s[dateLen] == 'T' || s[dateLen] == 't') {
+		s = s[:dateLen] + " " + s[dateLen+1:]
+	}
+	if strings.HasSuffix(s, "z") {
+		s = s[:len(s)-1] + "Z"
+	}
+	if i := strings.LastIndexAny(s, "+-"); i > dateLen {
+		offset := s[i+1:]
+		if len(offset) == 4 && !strings.Contains(offset, ":") {
+			offset = offset[:2] + ":" + offset[2:]
+		}
+		s = strings.TrimRight(s[:i], " ") + s[i:i+1] + offset
+	}
+	if strings.HasSuffix(s, " Z") {
+		s = s[:len(s)-2] + "Z"
+	}
+	return s
+}
+
+// jsonTimeLayout is RFC 3339 with a fixed microsecond precision, the postgres one.
+const jsonTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// formatJSONTime formats the given time for the JSON output: in UTC, rounded to the microsecond,
+// so a timestamp reads the same before and after a database round-trip.
+func formatJSONTime(t time.Time) string {
+	return t.UTC().Round(time.Microsecond).Format(jsonTimeLayout)
+}
+
+// NullTime is a nullable timestamp column, i.e. deleted_at selected on its own.
+// It scans SQL NULL as invalid and a timestamp, either a time.Time or its textual form, as valid,
+// so the column maps to a nil or non-nil *time.Time with Ptr, never to a non-nil zero time.
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// Scan implements sql.Scanner interface.
+func (nt *NullTime) Scan(src interface{}) error {
+	switch t := src.(type) {
+	case nil:
+		*nt = NullTime{}
+		return nil
+	case time.Time:
+		*nt = NullTime{Time: t.In(ScanLocation), Valid: true}
+		return nil
+	}
+	s, err := ScanToString(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for NullTime scan")
+	}
+	t, err := parseTimestamp(s)
+	if err != nil {
+		return errors.Wrap(err, "error parsing NullTime")
+	}
+	*nt = NullTime{Time: t, Valid: true}
+	return nil
+}
+
+// Value implements driver.Valuer interface.
+func (nt NullTime) Value() (driver.Value, error) {
+	if !nt.Valid {
+		return nil, nil
+	}
+	return nt.Time, nil
+}
+
+// Ptr returns a pointer to the time, nil if NULL.
+func (nt NullTime) Ptr() *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	t := nt.Time
+	return &t
+}
+
+// TimestampPtr returns a pointer to the time as a Timestamp, nil if NULL.
+func (nt NullTime) TimestampPtr() *Timestamp {
+	if !nt.Valid {
+		return nil
+	}
+	t := Timestamp(nt.Time)
+	return &t
+}
+
+// Timestamp is a time with a single canonical text form, shared by the database and JSON encodings:
+// RFC 3339 in UTC with a fixed microsecond precision, see formatJSONTime.
+// The TimeMetadata timestamps are of this type, so both encodings stay symmetric.
+// The zero Timestamp is SQL NULL and JSON null.
+type Timestamp time.Time
+
+// Time returns the timestamp as a time.Time.
+func (t Timestamp) Time() time.Time {
+	return time.Time(t)
+}
+
+// Now returns the current time as a Timestamp, in UTC.
+func Now() Timestamp {
+	return Timestamp(time.Now().UTC())
+}
+
+// Equal reports whether both timestamps are the same instant, whatever their location.
+func (t Timestamp) Equal(other Timestamp) bool {
+	return time.Time(t).Equal(time.Time(other))
+}
+
+// After reports whether t is after other.
+func (t Timestamp) After(other Timestamp) bool {
+	return time.Time(t).After(time.Time(other))
+}
+
+// IsZero returns true for the zero Timestamp.
+func (t Timestamp) IsZero() bool {
+	return time.Time(t).IsZero()
+}
+
+// String returns the canonical form of the timestamp.
+func (t Timestamp) String() string {
+	return formatJSONTime(time.Time(t))
+}
+
+// Scan implements sql.Scanner interface.
+// It accepts a time.Time or any textual timestamp understood by parseTimestamp. NULL scans as the zero Timestamp.
+func (t *Timestamp) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = Timestamp{}
+		return nil
+	case time.Time:
+		*t = Timestamp(v.In(ScanLocation))
+		return nil
+	}
+	s, err := ScanToString(src)
+	if err != nil {
+		return errors.Wrap(err, "invalid type for Timestamp scan")
+	}
+	return t.parse(s)
+}
+
+// Value implements driver.Valuer interface.
+// It emits the canonical form, NULL for the zero Timestamp.
+func (t Timestamp) Value() (driver.Value, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	return t.String(), nil
+}
+
+// MarshalJSON implements json.Marshaler interface.
+// It emits the canonical form, null for the zero Timestamp.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + t.String() + `"`), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// It accepts the same forms as Scan, null being the zero Timestamp.
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*t = Timestamp{}
+		return nil
+	}
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return errors.Wrap(err, "invalid Timestamp")
+	}
+	return t.parse(s)
+}
+
+// parse decodes the given textual timestamp into ScanLocation.
+func (t *Timestamp) parse(s string) error {
+	tt, err := parseTimestamp(s)
+	if err != nil {
+		return errors.Wrap(err, "error parsing Timestamp")
+	}
+	*t = Timestamp(tt)
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseTimestampScanLocation(t *testing.T) {
+	loc := time.FixedZone("EST", -5*60*60)
+	defer func(prev *time.Location) { ScanLocation = prev }(ScanLocation)
+	ScanLocation = loc
+
+	expect := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, s := range []string{
+		"2020-01-02 03:04:05+00",
+		"2020-01-02T03:04:05Z",
+		"2020-01-01 22:04:05-05",
+		"2020-01-02 04:04:05+0100",
+	} {
+		got, err := parseTimestamp(s)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %s", s, err)
+		}
+		if !got.Equal(expect) || got.Location() != loc {
+			t.Fatalf("%q: expected %s in %s, got %s in %s", s, expect, loc, got, got.Location())
+		}
+	}
+
+	var ts Timestamp
+	if err := json.Unmarshal([]byte(`"2020-01-02T03:04:05.000000Z"`), &ts); err != nil {
+		t.Fatalf("Error unmarshaling Timestamp: %s", err)
+	}
+	if ts.Time().Location() != loc {
+		t.Fatalf("Unexpected Timestamp location %s", ts.Time().Location())
+	}
+}
+
+func TestParseTimestampVariants(t *testing.T) {
+	expect := time.Date(2023, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	for _, s := range []string{
+		"2023-01-02 03:04:05.123456+00",
+		"2023-01-02 03:04:05.123456+00:00",
+		"2023-01-02 03:04:05.123456+0000",
+		"2023-01-02T03:04:05.123456Z",
+		"2023-01-02t03:04:05.123456z",
+		"2023-01-02 05:04:05.123456+02",
+		"2023-01-01 22:04:05.123456-05:00",
+		" 2023-01-02 03:04:05.123456 +00 ",
+	} {
+		got, err := parseTimestamp(s)
+		if err != nil {
+			t.Errorf("Error parsing %q: %s", s, err)
+			continue
+		}
+		if !got.Equal(expect) {
+			t.Errorf("%q: expected %s, got %s", s, expect, got)
+		}
+	}
+
+	if _, err := parseTimestamp("2023-01-02 03:04:05+xx"); err == nil {
+		t.Fatal("Expected an error for an invalid offset")
+	}
+
+	var m Metadata
+	if err := m.ScanLoose([]byte(`("2023-01-02T03:04:05.123456Z","2023-01-02 03:04:05.123456+00:00","2023-01-02 03:04:05.123456+00")`)); err != nil {
+		t.Fatalf("Error scanning Metadata: %s", err)
+	}
+	if !m.CreatedAt.Time().Equal(expect) || !m.UpdatedAt.Time().Equal(expect) || m.DeletedAt == nil || !m.DeletedAt.Time().Equal(expect) {
+		t.Fatalf("Unexpected Metadata %+v", m)
+	}
+}
+
+func TestNullTimeScan(t *testing.T) {
+	expect := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	nt := NullTime{Time: expect, Valid: true}
+	if err := nt.Scan(nil); err != nil {
+		t.Fatalf("Error scanning NULL: %s", err)
+	}
+	if nt.Valid || nt.Ptr() != nil || nt.TimestampPtr() != nil {
+		t.Fatalf("Expected a NULL time, got %+v", nt)
+	}
+	if v, err := nt.Value(); v != nil || err != nil {
+		t.Fatalf("Expected a NULL value, got %v (%v)", v, err)
+	}
+
+	for _, src := range []interface{}{expect, []byte("2020-01-02 03:04:05+00"), "2020-01-02 04:04:05+01"} {
+		var nt NullTime
+		if err := nt.Scan(src); err != nil {
+			t.Fatalf("Error scanning %v: %s", src, err)
+		}
+		if p := nt.Ptr(); p == nil || !p.Equal(expect) {
+			t.Fatalf("%v: expected %s, got %v", src, expect, p)
+		}
+		if p := nt.TimestampPtr(); p == nil || !p.Equal(Timestamp(expect)) {
+			t.Fatalf("%v: expected timestamp %s, got %v", src, expect, p)
+		}
+	}
+
+	if err := new(NullTime).Scan(42); err == nil {
+		t.Fatal("Expected an error scanning an int")
+	}
+}
+
+func TestTimeMetadataMarshalJSONFormat(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	for _, tc := range []struct {
+		t      time.Time
+		expect string
+	}{
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), `2020-01-02T03:04:05.000000Z`},
+		{time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC), `2020-01-02T03:04:05.123457Z`},
+		{time.Date(2020, 1, 1, 22, 4, 5, 120000000, est), `2020-01-02T03:04:05.120000Z`},
+	} {
+		tm := TimeMetadata{CreatedAt: Timestamp(tc.t), UpdatedAt: Timestamp(tc.t)}
+		buf, err := json.Marshal(tm)
+		if err != nil {
+			t.Fatalf("Error marshaling %s: %s", tc.t, err)
+		}
+		expect := `{"created_at":"` + tc.expect + `","updated_at":"` + tc.expect + `"}`
+		if string(buf) != expect {
+			t.Fatalf("Unexpected JSON %s, expected %s", buf, expect)
+		}
+
+		// The output is stable across round trips.
+		var decoded TimeMetadata
+		if err := json.Unmarshal(buf, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling %s: %s", buf, err)
+		}
+		again, err := json.Marshal(decoded)
+		if err != nil || string(again) != string(buf) {
+			t.Fatalf("Unstable JSON %s, expected %s (%v)", again, buf, err)
+		}
+	}
+}
+
+func TestTimeMetadataTimestamps(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 123456000, time.UTC))
+	for _, tm := range []TimeMetadata{
+		{CreatedAt: ts, UpdatedAt: ts},
+		{CreatedAt: ts, UpdatedAt: ts, DeletedAt: &ts},
+	} {
+		v, err := tm.Value()
+		if err != nil {
+			t.Fatalf("Error encoding TimeMetadata: %s", err)
+		}
+		var scanned TimeMetadata
+		if err := scanned.Scan1(v); err != nil {
+			t.Fatalf("Error scanning %v: %s", v, err)
+		}
+		if !scanned.Equal(tm) {
+			t.Fatalf("Composite round trip: expected %v, got %v", tm, scanned)
+		}
+
+		buf, err := json.Marshal(tm)
+		if err != nil {
+			t.Fatalf("Error marshaling TimeMetadata: %s", err)
+		}
+		var decoded TimeMetadata
+		if err := json.Unmarshal(buf, &decoded); err != nil {
+			t.Fatalf("Error unmarshaling %s: %s", buf, err)
+		}
+		if !decoded.Equal(tm) {
+			t.Fatalf("JSON round trip: expected %v, got %v", tm, decoded)
+		}
+	}
+
+	if got := formatQueryArg((*Timestamp)(nil)); got != "NULL" {
+		t.Fatalf("Expected a nil timestamp to format as NULL, got %s", got)
+	}
+}
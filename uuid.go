@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql/driver"
+	"strings"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+// newUUID generates the random UUIDs, swapped in tests for a deterministic sequence.
+var newUUID = uuid.NewRandom
+
+// MustParseUUID parses the given string as a UUID and panics if invalid.
+func MustParseUUID(s string) uuid.UUID {
+	id := uuid.Parse(s)
+	if id == nil {
+		panic(errors.Errorf("invalid uuid %q", s))
+	}
+	return id
+}
+
+// ParseUUIDOrNil parses the given string as a UUID.
+// Returns nil if the string is invalid or if it is the zero UUID (`uuid_nil()`).
+func ParseUUIDOrNil(s string) uuid.UUID {
+	id := uuid.Parse(s)
+	if IsNil(id) {
+		return nil
+	}
+	return id
+}
+
+// NilUUID is the all-zero UUID, the Go counterpart of the postgres `uuid_nil()`.
+var NilUUID = MustParseUUID("00000000-0000-0000-0000-000000000000")
+
+// IsNil returns true if the given UUID is empty:
+// either nil, zero-length or NilUUID.
+func IsNil(id uuid.UUID) bool {
+	return len(id) == 0 || uuid.Equal(id, NilUUID)
+}
+
+// IsNilUUID is IsNil, kept for the existing callers.
+//
+// Deprecated: use IsNil.
+func IsNilUUID(id uuid.UUID) bool {
+	return IsNil(id)
+}
+
+// UUIDArray is a postgres UUID array, i.e. the result of `array_agg(team_id)`.
+type UUIDArray []uuid.UUID
+
+// Scan implements sql.Scanner interface.
+// NULL elements, i.e. from an `array_agg` over a LEFT JOIN without match, are skipped.
+func (a *UUIDArray) Scan(src interface{}) error {
+	elems, err := parseArray(src)
+	if err != nil {
+		return errors.Wrap(err, "error parsing UUIDArray")
+	}
+	ids := make(UUIDArray, len(elems))
+	for i, elem := range elems {
+		if ids[i] = uuid.Parse(elem); ids[i] == nil {
+			return errors.Errorf("invalid uuid %q for UUIDArray element %d", elem, i)
+		}
+	}
+	*a = ids
+	return nil
+}
+
+// Value implements driver.Valuer interface.
+// A nil array is NULL and nil elements are NULL elements.
+func (a UUIDArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	elems := make([]string, len(a))
+	for i, id := range a {
+		if id == nil {
+			elems[i] = "NULL"
+			continue
+		}
+		elems[i] = id.String()
+	}
+	return "{" + strings.Join(elems, ",") + "}", nil
+}
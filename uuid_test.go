@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creack/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestParseUUIDOrNil(t *testing.T) {
+	for s, expect := range map[string]uuid.UUID{
+		"":                                     nil,
+		"nope":                                 nil,
+		"00000000-0000-0000-0000-000000000000": nil,
+		"00000000-0000-0000-0000-000000000001": MustParseUUID("00000000-0000-0000-0000-000000000001"),
+	} {
+		if got := ParseUUIDOrNil(s); !uuid.Equal(got, expect) {
+			t.Fatalf("%q: expected %v, got %v", s, expect, got)
+		}
+	}
+}
+
+func TestMustParseUUIDPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic for an invalid uuid")
+		}
+	}()
+	MustParseUUID("nope")
+}
+
+func TestMetadataUUIDNilOwner(t *testing.T) {
+	ts := Timestamp(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	for _, owner := range []*User{nil, {ID: NilUUID}} {
+		m := Metadata{Owner: owner, TimeMetadata: TimeMetadata{CreatedAt: ts, UpdatedAt: ts}}
+		v, err := m.Value()
+		if err != nil {
+			t.Fatalf("Error encoding %v: %s", m, err)
+		}
+		var scanned Metadata
+		if err := scanned.Scan1(v); err != nil {
+			t.Fatalf("Error scanning %q: %s", v, err)
+		}
+		if scanned.Owner != nil {
+			t.Fatalf("%q: expected a uuid_nil() owner to scan as no owner, got %v", v, scanned.Owner)
+		}
+	}
+}
+
+func TestIsNil(t *testing.T) {
+	for _, tc := range []struct {
+		id  uuid.UUID
+		nil bool
+	}{
+		{id: nil, nil: true},
+		{id: uuid.UUID{}, nil: true},
+		{id: MustParseUUID("00000000-0000-0000-0000-000000000000"), nil: true},
+		{id: MustParseUUID("00000000-0000-0000-0000-000000000001"), nil: false},
+	} {
+		if got := IsNil(tc.id); got != tc.nil {
+			t.Fatalf("IsNil(%q): expected %t, got %t", tc.id, tc.nil, got)
+		}
+		if got := IsNilUUID(tc.id); got != tc.nil {
+			t.Fatalf("IsNilUUID(%q): expected %t, got %t", tc.id, tc.nil, got)
+		}
+	}
+}
+
+func TestUUIDArrayScanValue(t *testing.T) {
+	for _, tc := range []struct {
+		src    string
+		expect int
+		value  string
+	}{
+		{src: `{}`, expect: 0, value: `{}`},
+		{src: `{00000000-0000-0000-0000-000000000001,00000000-0000-0000-0000-000000000002}`, expect: 2, value: `{00000000-0000-0000-0000-000000000001,00000000-0000-0000-0000-000000000002}`},
+		{src: `{00000000-0000-0000-0000-000000000001,NULL}`, expect: 1, value: `{00000000-0000-0000-0000-000000000001}`},
+	} {
+		var a UUIDArray
+		if err := a.Scan([]byte(tc.src)); err != nil {
+			t.Fatalf("Error scanning %s: %s", tc.src, err)
+		}
+		if len(a) != tc.expect {
+			t.Fatalf("%s: expected %d ids, got %v", tc.src, tc.expect, a)
+		}
+		v, err := a.Value()
+		if err != nil || v != tc.value {
+			t.Fatalf("%s: expected %s, got %v (%v)", tc.src, tc.value, v, err)
+		}
+	}
+
+	var a UUIDArray
+	if err := a.Scan(`{00000000-0000-0000-0000-000000000001,not-a-uuid}`); err == nil {
+		t.Fatal("Expected an error for a malformed element")
+	}
+	if v, err := UUIDArray(nil).Value(); v != nil || err != nil {
+		t.Fatalf("Expected a NULL array, got %v (%v)", v, err)
+	}
+}
+
+func TestNewUUIDSeam(t *testing.T) {
+	defer func(prev func() uuid.UUID) { newUUID = prev }(newUUID)
+	n := 0
+	newUUID = func() uuid.UUID {
+		n++
+		return MustParseUUID(fmt.Sprintf("00000000-0000-0000-0000-%012d", n))
+	}
+
+	u, o, team, pp := NewUser(), NewOrganization(), NewTeam("devs", 0), NewPaymentPlan("pro", 1, "USD", TermMonthly)
+	for i, id := range []uuid.UUID{u.ID, o.ID, team.ID, pp.ID} {
+		if expect := fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1); id.String() != expect {
+			t.Fatalf("Expected %s, got %s", expect, id)
+		}
+	}
+
+	var buf bytes.Buffer
+	r := NewUserRepository(sqlx.NewDb(nil, "postgres"), WithDryRun(&buf))
+	inserted := &User{}
+	if err := r.Insert(context.Background(), inserted); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if inserted.ID.String() != "00000000-0000-0000-0000-000000000005" || !strings.Contains(buf.String(), "00000000-0000-0000-0000-000000000005") {
+		t.Fatalf("Expected the deterministic id to be inserted, got %s in:\n%s", inserted.ID, buf.String())
+	}
+}
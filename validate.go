@@ -0,0 +1,230 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/creack/uuid"
+	"github.com/pkg/errors"
+)
+
+// Validation errors.
+var (
+	errMissingUUID = errors.New("missing uuid")
+	errMissingName = errors.New("missing name")
+	errNilElement  = errors.New("nil element")
+)
+
+// Validator is implemented by the models able to check their own invariants.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError is a validation error located by its JSON field path, i.e. `organization_memberships[0].role`.
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+// Error implements error interface.
+func (fe *FieldError) Error() string {
+	if fe.Path == "" {
+		return fe.Err.Error()
+	}
+	return fe.Path + ": " + fe.Err.Error()
+}
+
+// Cause returns the underlying error.
+func (fe *FieldError) Cause() error { return fe.Err }
+
+// Unwrap returns the underlying error.
+func (fe *FieldError) Unwrap() error { return fe.Err }
+
+// ValidationErrors aggregates all the validation errors of a value.
+type ValidationErrors []*FieldError
+
+// Error implements error interface.
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, len(ve))
+	for i, fe := range ve {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the aggregated errors so errors.Is and errors.As look through them.
+func (ve ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(ve))
+	for i, fe := range ve {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// ValidateAll validates all the given values and returns all the problems at once.
+// Each field path is prefixed with the index of the value.
+func ValidateAll(vs ...Validator) error {
+	v := validation{}
+	for i, elem := range vs {
+		v.check("["+strconv.Itoa(i)+"]", elem.Validate())
+	}
+	return v.err()
+}
+
+// validation accumulates field errors.
+type validation struct {
+	errs ValidationErrors
+}
+
+// check records the given error under the given path.
+// Nested validation errors are flattened with their path prefixed.
+func (v *validation) check(path string, err error) {
+	switch e := err.(type) {
+	case nil:
+	case ValidationErrors:
+		for _, fe := range e {
+			v.errs = append(v.errs, &FieldError{Path: joinPath(path, fe.Path), Err: fe.Err})
+		}
+	case *FieldError:
+		v.errs = append(v.errs, &FieldError{Path: joinPath(path, e.Path), Err: e.Err})
+	default:
+		v.errs = append(v.errs, &FieldError{Path: path, Err: err})
+	}
+}
+
+// checkUUID records errMissingUUID when the given id is nil.
+func (v *validation) checkUUID(path string, id uuid.UUID) {
+	if id == nil {
+		v.check(path, errMissingUUID)
+	}
+}
+
+// err returns the accumulated errors, nil if none.
+func (v *validation) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// joinPath joins two field paths.
+func joinPath(prefix, path string) string {
+	switch {
+	case prefix == "":
+		return path
+	case path == "":
+		return prefix
+	case path[0] == '[':
+		return prefix + path
+	default:
+		return prefix + "." + path
+	}
+}
+
+// indexPath returns the path of the i-th element of the given field.
+func indexPath(field string, i int) string {
+	return field + "[" + strconv.Itoa(i) + "]"
+}
+
+// Validate implements Validator interface.
+func (m Metadata) Validate() error {
+	v := validation{}
+	if m.Owner != nil {
+		v.checkUUID("owner_id", m.Owner.ID)
+	}
+	if m.CreatedBy != nil {
+		v.checkUUID("created_by", m.CreatedBy.ID)
+	}
+	return v.err()
+}
+
+// Validate implements Validator interface.
+func (u *User) Validate() error {
+	v := validation{}
+	v.checkUUID("user_id", u.ID)
+	for i := range u.Organizations {
+		v.check(indexPath("organization_memberships", i), u.Organizations[i].Validate())
+	}
+	for i := range u.Teams {
+		v.check(indexPath("team_memberships", i), u.Teams[i].Validate())
+	}
+	if u.PaymentPlan != nil {
+		v.check("payment_plan", u.PaymentPlan.Validate())
+	}
+	v.check("metadata", u.Metadata.Validate())
+	return v.err()
+}
+
+// Validate implements Validator interface.
+func (uo *UserOrganization) Validate() error {
+	v := validation{}
+	v.checkUUID("user_id", uo.UserID)
+	v.checkUUID("organization_id", uo.OrganizationID)
+	if _, err := ParseRole(string(uo.Role)); err != nil {
+		v.check("role", err)
+	}
+	v.check("metadata", uo.Metadata.Validate())
+	return v.err()
+}
+
+// Validate implements Validator interface.
+func (ut *UserTeam) Validate() error {
+	v := validation{}
+	v.checkUUID("user_id", ut.UserID)
+	v.checkUUID("organization_id", ut.OrganizationID)
+	if _, err := ParseRole(string(ut.Role)); err != nil {
+		v.check("role", err)
+	}
+	v.check("metadata", ut.Metadata.Validate())
+	return v.err()
+}
+
+// Validate implements Validator interface.
+func (o *Organization) Validate() error {
+	v := validation{}
+	v.checkUUID("organization_id", o.ID)
+	for i, uo := range o.Users {
+		if uo == nil {
+			v.check(indexPath("users", i), errNilElement)
+			continue
+		}
+		v.check(indexPath("users", i), uo.Validate())
+	}
+	for i, t := range o.Teams {
+		if t == nil {
+			v.check(indexPath("teams", i), errNilElement)
+			continue
+		}
+		v.check(indexPath("teams", i), t.Validate())
+	}
+	if o.PaymentPlan != nil {
+		v.check("payment_plan", o.PaymentPlan.Validate())
+	}
+	v.check("metadata", o.Metadata.Validate())
+	return v.err()
+}
+
+// Validate implements Validator interface.
+func (t *Team) Validate() error {
+	v := validation{}
+	v.checkUUID("team_id", t.ID)
+	if t.Name == "" {
+		v.check("name", errMissingName)
+	}
+	switch {
+	case t.CapacityNull:
+	case t.Capacity < 0:
+		v.check("capacity", errors.Errorf("invalid negative capacity %d", t.Capacity))
+	case t.Capacity > 0 && len(t.Users) > t.Capacity:
+		v.check("users", errors.Errorf("%d users exceed the capacity of %d", len(t.Users), t.Capacity))
+	}
+	for i, ut := range t.Users {
+		if ut == nil {
+			v.check(indexPath("users", i), errNilElement)
+			continue
+		}
+		v.check(indexPath("users", i), ut.Validate())
+	}
+	v.check("metadata", t.Metadata.Validate())
+	return v.err()
+}
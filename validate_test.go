@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateAll(t *testing.T) {
+	userID := MustParseUUID("00000000-0000-0000-0000-000000000001")
+	u := &User{ID: userID}
+	if err := ValidateAll(u, NewPaymentPlan("pro", 1, "USD", TermMonthly), NewTeam("core", 0)); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	invalid := &User{
+		ID: userID,
+		Organizations: UserOrganizations{{
+			UserID:         userID,
+			OrganizationID: MustParseUUID("00000000-0000-0000-0000-000000000002"),
+			Role:           Role("root"),
+		}},
+	}
+	err := ValidateAll(u, invalid, &PaymentPlan{Cost: -1, Currency: "USD", Term: TermMonthly}, &Team{})
+	var ve ValidationErrors
+	if !errors.As(err, &ve) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	paths := map[string]bool{}
+	for _, fe := range ve {
+		paths[fe.Path] = true
+	}
+	for _, path := range []string{
+		"[1].organization_memberships[0].role",
+		"[2].payment_plan_id",
+		"[2].cost",
+		"[3].team_id",
+		"[3].name",
+	} {
+		if !paths[path] {
+			t.Fatalf("Missing error for %s in %v", path, err)
+		}
+	}
+	if !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("Expected the error to match ErrInvalidRole: %v", err)
+	}
+}
+
+func TestStrictScan(t *testing.T) {
+	defer func(prev bool) { StrictScan = prev }(StrictScan)
+
+	const ts = `"2020-01-02 03:04:05+00"`
+	for _, tc := range []struct {
+		dest interface{ Scan(interface{}) error }
+		src  string
+	}{
+		{&PaymentPlan{}, `(00000000-0000-0000-0000-000000000001,refund,-1,USD,Monthly,,` + ts + `,` + ts + `,)`},
+		{&Team{}, `(00000000-0000-0000-0000-000000000001,,devs,-1,,` + ts + `,` + ts + `,)`},
+		// A membership of the user 0a in the organization 0b, owned by the user 01.
+		{&UserOrganization{}, `(00000000-0000-0000-0000-00000000000b,00000000-0000-0000-0000-00000000000a,member,00000000-0000-0000-0000-000000000001,` + ts + `,` + ts + `,)`},
+	} {
+		StrictScan = false
+		if err := tc.dest.Scan(tc.src); err != nil {
+			t.Fatalf("Expected the lenient mode to accept %s, got %s", tc.src, err)
+		}
+		StrictScan = true
+		if err := tc.dest.Scan(tc.src); err == nil {
+			t.Fatalf("Expected the strict mode to reject %s", tc.src)
+		}
+	}
+
+	// The membership owned by its user or organization is accepted in strict mode.
+	StrictScan = true
+	for _, owner := range []string{"00000000-0000-0000-0000-00000000000a", "00000000-0000-0000-0000-00000000000b", ""} {
+		src := `(00000000-0000-0000-0000-00000000000b,00000000-0000-0000-0000-00000000000a,member,` + owner + `,` + ts + `,` + ts + `,)`
+		if err := new(UserOrganization).Scan(src); err != nil {
+			t.Fatalf("Expected the strict mode to accept %s, got %s", src, err)
+		}
+	}
+
+	// The unknown roles are rejected either way.
+	for _, strict := range []bool{false, true} {
+		StrictScan = strict
+		err := new(UserOrganization).Scan(`(00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,superuser,"(,` + strings.Replace(ts, `"`, `""`, -1) + `,` + strings.Replace(ts, `"`, `""`, -1) + `,)")`)
+		if !errors.Is(err, ErrInvalidRole) {
+			t.Fatalf("strict=%t: expected ErrInvalidRole, got %v", strict, err)
+		}
+	}
+}